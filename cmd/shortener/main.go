@@ -8,7 +8,6 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/eugene982/url-shortener/internal/app"
 	"github.com/eugene982/url-shortener/internal/config"
@@ -19,7 +18,7 @@ import (
 
 const (
 	// сколько ждём времени на корректное завершение работы сервера
-	closeServerTimeout = time.Second * 3
+	closeServerTimeout = app.StopTimeout
 )
 
 var (
@@ -34,6 +33,13 @@ func main() {
 	fmt.Println("Build date:", buildDate)
 	fmt.Println("Build commit:", buildCommit)
 
+	run := run
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		// флаги подкоманды разбираются как флаги сервиса
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		run = runMigrate
+	}
+
 	if err := run(); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/eugene982/url-shortener/internal/config"
+	"github.com/eugene982/url-shortener/internal/logger/zaplogger"
+	"github.com/eugene982/url-shortener/internal/storage/boltstore"
+	"github.com/eugene982/url-shortener/internal/storage/pgxstore"
+	"github.com/eugene982/url-shortener/internal/storage/sqlitestore"
+)
+
+// имя подкоманды управления схемой базы
+const migrateCommand = "migrate"
+
+// Управление схемой базы postgres:
+//
+//	shortener migrate [флаги] [up [N] | down [N] | status]
+//
+// up применяет N или все новые миграции, down откатывает N последних, по умолчанию одну.
+func runMigrate() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	conf, err := config.Config()
+	if err != nil {
+		return err
+	}
+
+	if err = zaplogger.Initialize(conf.LogLevel); err != nil {
+		return err
+	}
+
+	command, n, err := parseMigrateArgs(flag.Args())
+	if err != nil {
+		return err
+	}
+
+	if conf.DatabaseDSN == "" ||
+		strings.HasPrefix(conf.DatabaseDSN, sqlitestore.Scheme) ||
+		strings.HasPrefix(conf.DatabaseDSN, boltstore.Scheme) {
+		return fmt.Errorf("migrate requires postgres database dsn")
+	}
+
+	// миграциям хватает одного соединения
+	db, err := pgxstore.Open(ctx, conf.DatabaseDSN, pgxstore.PoolConfig{
+		MaxConns: 1,
+		ExecMode: conf.DatabaseExecMode,
+	})
+	if err != nil {
+		return fmt.Errorf("error open postgres pool: %w", err)
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		err = pgxstore.MigrateUp(ctx, db, n)
+	case "down":
+		err = pgxstore.MigrateDown(ctx, db, n)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, latest, err := pgxstore.SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d of %d\n", current, latest)
+	return nil
+}
+
+// разбор аргументов подкоманды: действие и количество миграций
+func parseMigrateArgs(args []string) (command string, n int, err error) {
+	command = "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		n = 0 // все
+	case "down":
+		n = 1
+	case "status":
+		if len(args) > 1 {
+			return "", 0, fmt.Errorf("migrate status has no arguments")
+		}
+		return command, 0, nil
+	default:
+		return "", 0, fmt.Errorf("unknown migrate command %q, want up, down or status", command)
+	}
+
+	if len(args) > 2 {
+		return "", 0, fmt.Errorf("too many migrate arguments")
+	}
+	if len(args) == 2 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+			return "", 0, fmt.Errorf("wrong migrations count %q", args[1])
+		}
+	}
+	return command, n, nil
+}
@@ -20,12 +20,15 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Shortener_Ping_FullMethodName        = "/url_shortener.v1.Shortener/Ping"
-	Shortener_FindAddr_FullMethodName    = "/url_shortener.v1.Shortener/FindAddr"
-	Shortener_CreateShort_FullMethodName = "/url_shortener.v1.Shortener/CreateShort"
-	Shortener_BatchShort_FullMethodName  = "/url_shortener.v1.Shortener/BatchShort"
-	Shortener_GetUserURLs_FullMethodName = "/url_shortener.v1.Shortener/GetUserURLs"
-	Shortener_DelUserURLs_FullMethodName = "/url_shortener.v1.Shortener/DelUserURLs"
+	Shortener_Ping_FullMethodName            = "/url_shortener.v1.Shortener/Ping"
+	Shortener_FindAddr_FullMethodName        = "/url_shortener.v1.Shortener/FindAddr"
+	Shortener_CreateShort_FullMethodName     = "/url_shortener.v1.Shortener/CreateShort"
+	Shortener_BatchShort_FullMethodName      = "/url_shortener.v1.Shortener/BatchShort"
+	Shortener_GetUserURLs_FullMethodName     = "/url_shortener.v1.Shortener/GetUserURLs"
+	Shortener_DelUserURLs_FullMethodName     = "/url_shortener.v1.Shortener/DelUserURLs"
+	Shortener_GetDeleteJob_FullMethodName    = "/url_shortener.v1.Shortener/GetDeleteJob"
+	Shortener_GetUserTrash_FullMethodName    = "/url_shortener.v1.Shortener/GetUserTrash"
+	Shortener_RestoreUserURLs_FullMethodName = "/url_shortener.v1.Shortener/RestoreUserURLs"
 )
 
 // ShortenerClient is the client API for Shortener service.
@@ -42,8 +45,14 @@ type ShortenerClient interface {
 	BatchShort(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
 	// GetUserURLs получение списка пользовательских ссылок
 	GetUserURLs(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (*UserURLsResponse, error)
-	// DelUserURLs удаление пользовательских ссылок
-	DelUserURLs(ctx context.Context, in *DelUserURLsRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	// DelUserURLs асинхронное удаление пользовательских ссылок
+	DelUserURLs(ctx context.Context, in *DelUserURLsRequest, opts ...grpc.CallOption) (*DelUserURLsResponse, error)
+	// GetDeleteJob состояние задачи удаления пользовательских ссылок
+	GetDeleteJob(ctx context.Context, in *DeleteJobRequest, opts ...grpc.CallOption) (*DeleteJobResponse, error)
+	// GetUserTrash список удалённых пользовательских ссылок, доступных для восстановления
+	GetUserTrash(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (*UserTrashResponse, error)
+	// RestoreUserURLs восстановление удалённых пользовательских ссылок
+	RestoreUserURLs(ctx context.Context, in *RestoreUserURLsRequest, opts ...grpc.CallOption) (*RestoreUserURLsResponse, error)
 }
 
 type shortenerClient struct {
@@ -99,8 +108,8 @@ func (c *shortenerClient) GetUserURLs(ctx context.Context, in *UserURLsRequest,
 	return out, nil
 }
 
-func (c *shortenerClient) DelUserURLs(ctx context.Context, in *DelUserURLsRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
-	out := new(empty.Empty)
+func (c *shortenerClient) DelUserURLs(ctx context.Context, in *DelUserURLsRequest, opts ...grpc.CallOption) (*DelUserURLsResponse, error) {
+	out := new(DelUserURLsResponse)
 	err := c.cc.Invoke(ctx, Shortener_DelUserURLs_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -108,6 +117,33 @@ func (c *shortenerClient) DelUserURLs(ctx context.Context, in *DelUserURLsReques
 	return out, nil
 }
 
+func (c *shortenerClient) GetDeleteJob(ctx context.Context, in *DeleteJobRequest, opts ...grpc.CallOption) (*DeleteJobResponse, error) {
+	out := new(DeleteJobResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetDeleteJob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetUserTrash(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (*UserTrashResponse, error) {
+	out := new(UserTrashResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetUserTrash_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) RestoreUserURLs(ctx context.Context, in *RestoreUserURLsRequest, opts ...grpc.CallOption) (*RestoreUserURLsResponse, error) {
+	out := new(RestoreUserURLsResponse)
+	err := c.cc.Invoke(ctx, Shortener_RestoreUserURLs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
@@ -122,8 +158,14 @@ type ShortenerServer interface {
 	BatchShort(context.Context, *BatchRequest) (*BatchResponse, error)
 	// GetUserURLs получение списка пользовательских ссылок
 	GetUserURLs(context.Context, *UserURLsRequest) (*UserURLsResponse, error)
-	// DelUserURLs удаление пользовательских ссылок
-	DelUserURLs(context.Context, *DelUserURLsRequest) (*empty.Empty, error)
+	// DelUserURLs асинхронное удаление пользовательских ссылок
+	DelUserURLs(context.Context, *DelUserURLsRequest) (*DelUserURLsResponse, error)
+	// GetDeleteJob состояние задачи удаления пользовательских ссылок
+	GetDeleteJob(context.Context, *DeleteJobRequest) (*DeleteJobResponse, error)
+	// GetUserTrash список удалённых пользовательских ссылок, доступных для восстановления
+	GetUserTrash(context.Context, *UserURLsRequest) (*UserTrashResponse, error)
+	// RestoreUserURLs восстановление удалённых пользовательских ссылок
+	RestoreUserURLs(context.Context, *RestoreUserURLsRequest) (*RestoreUserURLsResponse, error)
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -146,9 +188,18 @@ func (UnimplementedShortenerServer) BatchShort(context.Context, *BatchRequest) (
 func (UnimplementedShortenerServer) GetUserURLs(context.Context, *UserURLsRequest) (*UserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserURLs not implemented")
 }
-func (UnimplementedShortenerServer) DelUserURLs(context.Context, *DelUserURLsRequest) (*empty.Empty, error) {
+func (UnimplementedShortenerServer) DelUserURLs(context.Context, *DelUserURLsRequest) (*DelUserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DelUserURLs not implemented")
 }
+func (UnimplementedShortenerServer) GetDeleteJob(context.Context, *DeleteJobRequest) (*DeleteJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeleteJob not implemented")
+}
+func (UnimplementedShortenerServer) GetUserTrash(context.Context, *UserURLsRequest) (*UserTrashResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserTrash not implemented")
+}
+func (UnimplementedShortenerServer) RestoreUserURLs(context.Context, *RestoreUserURLsRequest) (*RestoreUserURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreUserURLs not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -270,6 +321,60 @@ func _Shortener_DelUserURLs_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_GetDeleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetDeleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetDeleteJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetDeleteJob(ctx, req.(*DeleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetUserTrash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetUserTrash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetUserTrash_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetUserTrash(ctx, req.(*UserURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_RestoreUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreUserURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).RestoreUserURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_RestoreUserURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).RestoreUserURLs(ctx, req.(*RestoreUserURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -301,6 +406,18 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DelUserURLs",
 			Handler:    _Shortener_DelUserURLs_Handler,
 		},
+		{
+			MethodName: "GetDeleteJob",
+			Handler:    _Shortener_GetDeleteJob_Handler,
+		},
+		{
+			MethodName: "GetUserTrash",
+			Handler:    _Shortener_GetUserTrash_Handler,
+		},
+		{
+			MethodName: "RestoreUserURLs",
+			Handler:    _Shortener_RestoreUserURLs_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/v1/shortener.proto",
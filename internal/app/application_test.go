@@ -2,12 +2,21 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/eugene982/url-shortener/internal/config"
+	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/shortener"
 	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/boltstore"
+	"github.com/eugene982/url-shortener/internal/storage/memstore"
+	"github.com/eugene982/url-shortener/internal/storage/sqlitestore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,6 +26,7 @@ type mokStore struct {
 	updFunc         func(d ...model.StoreData) error
 	getUserURLsFunc func() ([]model.StoreData, error)
 	getStats        func() (int, int, error)
+	delUserFunc     func(string, []string) ([]string, error)
 }
 
 func (m mokStore) GetAddr(_ context.Context, s string) (model.StoreData, error) {
@@ -28,7 +38,22 @@ func (m mokStore) Set(_ context.Context, d model.StoreData) error {
 func (m mokStore) GetUserURLs(_ context.Context, userID string) ([]model.StoreData, error) {
 	return m.getUserURLsFunc()
 }
-func (m mokStore) DeleteShort(ctx context.Context, shortURLs []string) error  { return nil }
+func (m mokStore) DeleteShort(ctx context.Context, shortURLs []string) error { return nil }
+func (m mokStore) DeleteUserShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	if m.delUserFunc == nil {
+		return nil, nil
+	}
+	return m.delUserFunc(userID, shortURLs)
+}
+func (m mokStore) RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	return nil, nil
+}
+func (m mokStore) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	return nil, nil
+}
+func (m mokStore) PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) ([]string, error) {
+	return nil, nil
+}
 func (m mokStore) Stats(ctx context.Context) (URLs int, users int, err error) { return m.getStats() }
 func (m mokStore) Update(_ context.Context, ls []model.StoreData) error       { return m.updFunc(ls...) }
 func (mokStore) Ping(context.Context) error                                   { return nil }
@@ -78,12 +103,14 @@ func TestNewApplication(t *testing.T) {
 		err := a.Start()
 		require.NoError(t, err)
 	}()
-	go a.startDeletionShortUrls()
-	a.DeleteUserShortAsync("user", []string{"ya.ru"})
+
+	jobID, err := a.DeleteUserShortAsync("user", []string{"ya.ru"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, jobID)
 
 	time.Sleep(time.Second)
 
-	err := a.Stop()
+	err = a.Stop()
 	require.NoError(t, err)
 }
 
@@ -105,3 +132,376 @@ func TestNewApplicationDSN(t *testing.T) {
 	_, err := New(conf)
 	require.Error(t, err)
 }
+
+func TestNewApplicationSQLite(t *testing.T) {
+	conf := config.Configuration{
+		DatabaseDSN: "sqlite://" + filepath.Join(t.TempDir(), "short-url.db"),
+	}
+	a, err := New(conf)
+	require.NoError(t, err)
+	assert.IsType(t, &sqlitestore.SQLiteStore{}, a.store)
+	require.NoError(t, a.store.Close())
+}
+
+func TestNewApplicationBolt(t *testing.T) {
+	conf := config.Configuration{
+		DatabaseDSN: "bolt://" + filepath.Join(t.TempDir(), "short-url.db"),
+	}
+	a, err := New(conf)
+	require.NoError(t, err)
+	assert.IsType(t, &boltstore.BoltStore{}, a.store)
+	require.NoError(t, a.store.Close())
+}
+
+func TestNewApplicationShortener(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Configuration
+		want    shortener.Shortener
+		wantErr bool
+	}{
+		{"default", config.Configuration{}, &shortener.SimpleShortener{}, false},
+		{"random", config.Configuration{ShortStrategy: "random", ShortLength: 12}, &shortener.RandomShortener{}, false},
+		{"counter", config.Configuration{ShortStrategy: "counter", ShortSalt: "salt"}, &shortener.CounterShortener{}, false},
+		{"id block", config.Configuration{ShortStrategy: "counter", ShortIDBlock: -1}, nil, true},
+		{"unknown", config.Configuration{ShortStrategy: "crc"}, nil, true},
+		{"alphabet", config.Configuration{ShortAlphabet: "a/b"}, nil, true},
+		{"length", config.Configuration{ShortLength: 21}, nil, true},
+		{"blocklist", config.Configuration{ShortBlocklist: "not-exists.txt"}, nil, true},
+		{"dedupe", config.Configuration{DedupeScope: "team"}, nil, true},
+		{"hash without dedupe", config.Configuration{DedupeScope: "none"}, nil, true},
+		{"random without dedupe", config.Configuration{DedupeScope: "none", ShortStrategy: "random"},
+			&shortener.RandomShortener{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(tt.conf)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			// повторы после коллизий учитываются
+			require.IsType(t, &shortener.Metered{}, a.shortener)
+			// и ссылки проверяются фильтром
+			filtered, ok := a.shortener.(*shortener.Metered).Shortener.(*shortener.Filtered)
+			require.True(t, ok)
+			assert.IsType(t, tt.want, filtered.Shortener)
+			require.NoError(t, a.store.Close())
+		})
+	}
+}
+
+func TestNewApplicationFilter(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(fname, []byte("bad\n"), 0600))
+
+	a, err := New(config.Configuration{ShortBlocklist: fname})
+	require.NoError(t, err)
+	defer a.store.Close()
+
+	assert.ErrorIs(t, shortener.CheckAlias(a.shortener, "notbad"), shortener.ErrRejected)
+	// пути сервиса зарезервированы
+	assert.ErrorIs(t, shortener.CheckAlias(a.shortener, "ping"), shortener.ErrRejected)
+	assert.NoError(t, shortener.CheckAlias(a.shortener, "good"))
+}
+
+func TestNewApplicationDedupe(t *testing.T) {
+	a, err := New(config.Configuration{DedupeScope: "user"})
+	require.NoError(t, err)
+	defer a.store.Close()
+
+	ctx := context.Background()
+	short1, err := handlers.GetAndWriteUserShort(ctx, a.shortener, a.store, "u1", "http://ya.ru", "", nil)
+	require.NoError(t, err)
+	// тот же адрес другого пользователя получает свою ссылку
+	short2, err := handlers.GetAndWriteUserShort(ctx, a.shortener, a.store, "u2", "http://ya.ru", "", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, short1, short2)
+
+	short, err := handlers.GetAndWriteUserShort(ctx, a.shortener, a.store, "u1", "http://ya.ru", "", nil)
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+	assert.Equal(t, short1, short)
+}
+
+func TestNewApplicationNoDedupe(t *testing.T) {
+	a, err := New(config.Configuration{DedupeScope: "none", ShortStrategy: "random"})
+	require.NoError(t, err)
+	defer a.store.Close()
+
+	// каждое сокращение адреса получает свою ссылку,
+	// сколько бы раз его ни сокращали
+	ctx := context.Background()
+	shorts := make(map[string]bool)
+	for i := 0; i < 2*handlers.ShortAttempts; i++ {
+		short, err := handlers.GetAndWriteUserShort(ctx, a.shortener, a.store, "u1", "http://ya.ru", "", nil)
+		require.NoError(t, err)
+		shorts[short] = true
+	}
+	assert.Len(t, shorts, 2*handlers.ShortAttempts)
+}
+
+func TestSweepExpired(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Set(ctx, model.StoreData{
+			UserID:      "user",
+			ShortURL:    fmt.Sprintf("s%d", i),
+			OriginalURL: fmt.Sprintf("http://%d.ru", i),
+			ExpiresAt:   &past,
+		}))
+	}
+	require.NoError(t, store.Set(ctx, model.StoreData{
+		UserID: "user", ShortURL: "live", OriginalURL: "http://live.ru", ExpiresAt: &future,
+	}))
+
+	// проходы порциями, пока истёкшие не кончатся
+	a := &Application{store: store, sweepBatch: 2}
+	assert.Equal(t, 5, a.sweepExpired(ctx))
+	assert.Equal(t, 0, a.sweepExpired(ctx))
+
+	urls, _, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, urls)
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	shorts := make([]string, 5)
+	for i := range shorts {
+		shorts[i] = fmt.Sprintf("s%d", i)
+		require.NoError(t, store.Set(ctx, model.StoreData{
+			UserID:      "user",
+			ShortURL:    shorts[i],
+			OriginalURL: fmt.Sprintf("http://%d.ru", i),
+		}))
+	}
+	require.NoError(t, store.DeleteShort(ctx, shorts))
+
+	// срок хранения ещё не прошёл
+	a := &Application{store: store, purgeRetention: time.Hour, purgeBatch: 2, purgeFree: true}
+	assert.Equal(t, 0, a.purgeDeleted(ctx))
+
+	a.purgeRetention = -time.Minute
+	assert.Equal(t, 5, a.purgeDeleted(ctx))
+	assert.Equal(t, 0, a.purgeDeleted(ctx))
+
+	_, err = store.GetAddr(ctx, "s0")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+}
+
+func TestDeleteJobs(t *testing.T) {
+	a := newTestApp(t)
+
+	var deleted []string
+	failed := false
+	a.store = mokStore{
+		// пользователю принадлежит только s1
+		delUserFunc: func(userID string, shorts []string) ([]string, error) {
+			if failed {
+				return nil, errors.New("store is down")
+			}
+			for _, short := range shorts {
+				if userID == "user" && short == "s1" {
+					deleted = append(deleted, short)
+				}
+			}
+			return deleted, nil
+		},
+	}
+	ctx := context.Background()
+
+	t.Run("done", func(t *testing.T) {
+		id, err := a.DeleteUserShortAsync("user", []string{"s1", "s2"})
+		require.NoError(t, err)
+
+		job, ok := a.DeleteJob("user", id)
+		require.True(t, ok)
+		assert.Equal(t, model.DeleteJobPending, job.Status)
+
+		// чужая задача не видна
+		_, ok = a.DeleteJob("other", id)
+		assert.False(t, ok)
+
+		queue := a.deleteQueued(ctx, []queuedJob{{job: <-a.delShortChan}})
+		assert.Empty(t, queue)
+		assert.Equal(t, []string{"s1"}, deleted)
+
+		job, ok = a.DeleteJob("user", id)
+		require.True(t, ok)
+		assert.Equal(t, model.DeleteJobDone, job.Status)
+		assert.NotNil(t, job.FinishedAt)
+		assert.Equal(t, []model.DeleteURLResult{
+			{ShortURL: "s1", Status: model.DeleteURLDeleted},
+			{ShortURL: "s2", Status: model.DeleteURLNotFound},
+		}, job.Results)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		id, err := a.DeleteUserShortAsync("user", nil)
+		require.NoError(t, err)
+
+		job, ok := a.DeleteJob("user", id)
+		require.True(t, ok)
+		assert.Equal(t, model.DeleteJobDone, job.Status)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		failed = true
+		id, err := a.DeleteUserShortAsync("user", []string{"s1"})
+		require.NoError(t, err)
+
+		queue := []queuedJob{{job: <-a.delShortChan}}
+		for i := 1; i < delShortAttempts; i++ {
+			queue = a.deleteQueued(ctx, queue)
+			require.Len(t, queue, 1)
+
+			job, _ := a.DeleteJob("user", id)
+			assert.Equal(t, model.DeleteJobPending, job.Status)
+		}
+		queue = a.deleteQueued(ctx, queue)
+		assert.Empty(t, queue)
+
+		job, ok := a.DeleteJob("user", id)
+		require.True(t, ok)
+		assert.Equal(t, model.DeleteJobFailed, job.Status)
+		assert.Equal(t, "store is down", job.Error)
+
+		// завершённые задачи очищаются по сроку
+		a.delJobs.cleanup(time.Now().Add(time.Second))
+		_, ok = a.DeleteJob("user", id)
+		assert.False(t, ok)
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		for i := 0; i < cap(a.delShortChan); i++ {
+			_, err := a.DeleteUserShortAsync("user", []string{"s1"})
+			require.NoError(t, err)
+		}
+		_, err := a.DeleteUserShortAsync("user", []string{"s1"})
+		assert.ErrorIs(t, err, errDeleteQueueFull)
+	})
+}
+
+// хранилище, отказывающее в удалении ссылок пользователя failUser один раз
+type failOnceStore struct {
+	storage.Storage
+	failUser string
+	failed   bool
+}
+
+func (s *failOnceStore) DeleteUserShort(ctx context.Context, userID string, shorts []string) ([]string, error) {
+	if userID == s.failUser && !s.failed {
+		s.failed = true
+		return nil, errors.New("store is down")
+	}
+	return s.Storage.DeleteUserShort(ctx, userID, shorts)
+}
+
+func TestDeleteJobsRetry(t *testing.T) {
+	a := newTestApp(t)
+	ctx := context.Background()
+
+	mem, err := memstore.New("")
+	require.NoError(t, err)
+	defer mem.Close()
+	require.NoError(t, mem.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+		{UserID: "other", ShortURL: "s3", OriginalURL: "bing.com"},
+	}))
+	require.NoError(t, mem.DeleteShort(ctx, []string{"s2"}))
+	a.store = &failOnceStore{Storage: mem, failUser: "other"}
+
+	id1, err := a.DeleteUserShortAsync("user", []string{"s1", "s2", "s9"})
+	require.NoError(t, err)
+	id2, err := a.DeleteUserShortAsync("other", []string{"s3"})
+	require.NoError(t, err)
+
+	// ссылки user помечены первой попыткой, ошибка на other повторяет пачку
+	queue := []queuedJob{{job: <-a.delShortChan}, {job: <-a.delShortChan}}
+	queue = a.deleteQueued(ctx, queue)
+	require.Len(t, queue, 2)
+	assert.Empty(t, a.deleteQueued(ctx, queue))
+
+	// удалённая раньше задачи и неизвестная ссылки не удалены этой задачей
+	job, ok := a.DeleteJob("user", id1)
+	require.True(t, ok)
+	assert.Equal(t, []model.DeleteURLResult{
+		{ShortURL: "s1", Status: model.DeleteURLDeleted},
+		{ShortURL: "s2", Status: model.DeleteURLNotFound},
+		{ShortURL: "s9", Status: model.DeleteURLNotFound},
+	}, job.Results)
+
+	job, ok = a.DeleteJob("other", id2)
+	require.True(t, ok)
+	assert.Equal(t, []model.DeleteURLResult{
+		{ShortURL: "s3", Status: model.DeleteURLDeleted},
+	}, job.Results)
+}
+
+func TestDeleteQueueRestart(t *testing.T) {
+	conf := config.Configuration{
+		FileStoragePath: filepath.Join(t.TempDir(), "short-url-db.json"),
+	}
+	ctx := context.Background()
+
+	// задача принята, но до удаления сервис упал
+	a, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, a.store.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+	}))
+	id, err := a.DeleteUserShortAsync("user", []string{"s1"})
+	require.NoError(t, err)
+	require.NoError(t, a.store.Close())
+
+	// после запуска задача продолжается с прежним идентификатором
+	a, err = New(conf)
+	require.NoError(t, err)
+	queue := a.resumeDeletes(ctx)
+	require.Len(t, queue, 1)
+
+	job, ok := a.DeleteJob("user", id)
+	require.True(t, ok)
+	assert.Equal(t, model.DeleteJobPending, job.Status)
+
+	assert.Empty(t, a.deleteQueued(ctx, queue))
+	job, _ = a.DeleteJob("user", id)
+	assert.Equal(t, model.DeleteJobDone, job.Status)
+
+	data, err := a.store.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, data.DeletedFlag)
+
+	// выполненная задача подтверждена
+	assert.Empty(t, a.resumeDeletes(ctx))
+
+	// при остановке накопленные задачи выполняются
+	a.delWG.Add(1)
+	go a.startDeletionShortUrls(nil)
+	_, err = a.DeleteUserShortAsync("user", []string{"s2"})
+	require.NoError(t, err)
+	require.NoError(t, a.Stop())
+
+	a, err = New(conf)
+	require.NoError(t, err)
+	defer a.store.Close()
+
+	data, err = a.store.GetAddr(ctx, "s2")
+	require.NoError(t, err)
+	assert.True(t, data.DeletedFlag)
+	assert.Empty(t, a.resumeDeletes(ctx))
+}
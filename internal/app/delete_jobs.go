@@ -0,0 +1,121 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// Задачи асинхронного удаления ссылок.
+// Завершённые хранятся до очистки, чтобы пользователь успел узнать итог.
+type deleteJobs struct {
+	mx   sync.Mutex
+	jobs map[string]*model.DeleteJob
+}
+
+func newDeleteJobs() *deleteJobs {
+	return &deleteJobs{
+		jobs: make(map[string]*model.DeleteJob),
+	}
+}
+
+// новая задача в ожидании удаления
+func (j *deleteJobs) add(userID string, shorts []string) (model.DeleteJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return model.DeleteJob{}, err
+	}
+
+	job := &model.DeleteJob{
+		ID:        id,
+		UserID:    userID,
+		ShortURLs: shorts,
+		Status:    model.DeleteJobPending,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	j.jobs[id] = job
+	return *job, nil
+}
+
+// задача из надёжной очереди, не выполненная до перезапуска,
+// с прежним идентификатором
+func (j *deleteJobs) resume(job model.DeleteJob) model.DeleteJob {
+	job.Status = model.DeleteJobPending
+	job.Error = ""
+	job.Results = nil
+	job.FinishedAt = nil
+
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	j.jobs[job.ID] = &job
+	return job
+}
+
+// задача пользователя, чужие не видны
+func (j *deleteJobs) get(userID, id string) (model.DeleteJob, bool) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok || job.UserID != userID {
+		return model.DeleteJob{}, false
+	}
+	return *job, true
+}
+
+// завершение задачи с итогом по каждой ссылке или с ошибкой
+func (j *deleteJobs) finish(id string, results []model.DeleteURLResult, err error) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	if err != nil {
+		job.Status = model.DeleteJobFailed
+		job.Error = err.Error()
+		return
+	}
+	job.Status = model.DeleteJobDone
+	job.Results = results
+}
+
+func (j *deleteJobs) remove(id string) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	delete(j.jobs, id)
+}
+
+// удаление задач, завершённых раньше before
+func (j *deleteJobs) cleanup(before time.Time) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	for id, job := range j.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(before) {
+			delete(j.jobs, id)
+		}
+	}
+}
+
+// случайный идентификатор задачи
+func newJobID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/eugene982/url-shortener/internal/handlers/api/user/urls"
 	"github.com/eugene982/url-shortener/internal/handlers/ping"
 	"github.com/eugene982/url-shortener/internal/handlers/root"
+	"github.com/eugene982/url-shortener/internal/storage"
 )
 
 type protoServer struct {
@@ -26,6 +27,9 @@ type protoServer struct {
 	batchHandler       handlers.BatchShortHandler
 	userURLsHandler    handlers.GetUserURLsHandler
 	delUserURLsHandler handlers.DelUserURLsHandler
+	userTrashHandler   handlers.GetUserTrashHandler
+	restoreHandler     handlers.RestoreUserURLsHandler
+	deleteJobHandler   handlers.GetDeleteJobHandler
 }
 
 type GRPCServer struct {
@@ -52,7 +56,8 @@ func NewGRPCServer(a *Application, addr string) (*GRPCServer, error) {
 	}
 
 	// создаём gRPC-сервер без зарегистрированной службы с прослойкой валидации входящих данных
-	srv.server = grpc.NewServer(grpc.UnaryInterceptor(
+	srv.server = grpc.NewServer(grpc.ChainUnaryInterceptor(
+		sessionInterceptor,
 		protovalidate_middleware.UnaryServerInterceptor(validator),
 	))
 
@@ -60,9 +65,12 @@ func NewGRPCServer(a *Application, addr string) (*GRPCServer, error) {
 		pingHandler:        ping.NewGRPCPingHandler(a.store),
 		findHandler:        root.NewGRPCFindAddrHandler(a.store),
 		createHandler:      root.NewGRPCCreateShortHandler(a.baseURL, a.store, a.shortener),
-		batchHandler:       batch.NewGRPCBatchHandler(a.baseURL, a.store, a.shortener),
+		batchHandler:       batch.NewGRPCBatchHandler(a.baseURL, a.store, a.shortener, a.dedupe),
 		userURLsHandler:    urls.NewGRPCUserURLsHandler(a.baseURL, a.store),
 		delUserURLsHandler: urls.NewGRPCDeleteURLsHandlers(a),
+		userTrashHandler:   urls.NewGRPCUserTrashHandler(a.baseURL, a.purgeRetention, a.store),
+		restoreHandler:     urls.NewGRPCRestoreURLsHandler(a.purgeRetention, a.store),
+		deleteJobHandler:   urls.NewGRPCDeleteJobHandler(a),
 	}
 
 	// регистрируем сервис
@@ -71,6 +79,11 @@ func NewGRPCServer(a *Application, addr string) (*GRPCServer, error) {
 	return &srv, nil
 }
 
+// прослойка сессии хранилища на время вызова, чтобы чтения после записи видели записанное
+func sessionInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(storage.WithSession(ctx), req)
+}
+
 func (s *GRPCServer) Start() error {
 	return s.server.Serve(s.listen)
 }
@@ -95,6 +108,18 @@ func (s *protoServer) GetUserURLs(ctx context.Context, in *proto.UserURLsRequest
 	return s.userURLsHandler(ctx, in)
 }
 
-func (s *protoServer) DelUserURLs(ctx context.Context, in *proto.DelUserURLsRequest) (*empty.Empty, error) {
+func (s *protoServer) DelUserURLs(ctx context.Context, in *proto.DelUserURLsRequest) (*proto.DelUserURLsResponse, error) {
 	return s.delUserURLsHandler(ctx, in)
 }
+
+func (s *protoServer) GetDeleteJob(ctx context.Context, in *proto.DeleteJobRequest) (*proto.DeleteJobResponse, error) {
+	return s.deleteJobHandler(ctx, in)
+}
+
+func (s *protoServer) GetUserTrash(ctx context.Context, in *proto.UserURLsRequest) (*proto.UserTrashResponse, error) {
+	return s.userTrashHandler(ctx, in)
+}
+
+func (s *protoServer) RestoreUserURLs(ctx context.Context, in *proto.RestoreUserURLsRequest) (*proto.RestoreUserURLsResponse, error) {
+	return s.restoreHandler(ctx, in)
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
+	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -51,7 +52,14 @@ func TestGRPCServer(t *testing.T) {
 	t.Run("del urls", func(t *testing.T) {
 		resp, err := server.proto.DelUserURLs(ctx, &proto.DelUserURLsRequest{})
 		require.NoError(t, err)
-		assert.NotNil(t, resp)
+		assert.NotEmpty(t, resp.JobId)
+
+		job, err := server.proto.GetDeleteJob(ctx, &proto.DeleteJobRequest{JobId: resp.JobId})
+		require.NoError(t, err)
+		assert.Equal(t, string(model.DeleteJobDone), job.Status)
+
+		_, err = server.proto.GetDeleteJob(ctx, &proto.DeleteJobRequest{JobId: "-"})
+		assert.Error(t, err)
 	})
 
 }
@@ -3,18 +3,21 @@ package app
 import (
 	"net/http"
 	"net/http/pprof"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/eugene982/url-shortener/internal/logger"
 	"github.com/eugene982/url-shortener/internal/middleware"
 
+	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/handlers/api/intrnl/stats"
 	"github.com/eugene982/url-shortener/internal/handlers/api/shorten"
 	"github.com/eugene982/url-shortener/internal/handlers/api/shorten/batch"
 	"github.com/eugene982/url-shortener/internal/handlers/api/user/urls"
 	"github.com/eugene982/url-shortener/internal/handlers/ping"
 	"github.com/eugene982/url-shortener/internal/handlers/root"
+	"github.com/eugene982/url-shortener/internal/storage"
 )
 
 // NewRouter функция создаёт и возвращает роутер.
@@ -22,8 +25,9 @@ func NewRouter(a *Application) http.Handler {
 
 	r := chi.NewRouter()
 
-	r.Use(middleware.Log)  // прослойка логирования
-	r.Use(middleware.Gzip) // прослойка сжатия
+	r.Use(middleware.Log)     // прослойка логирования
+	r.Use(middleware.Gzip)    // прослойка сжатия
+	r.Use(middleware.Session) // чтение своих записей в пределах запроса
 
 	// Прослойка авторизации
 	r.Use(middleware.Auth)
@@ -33,10 +37,13 @@ func NewRouter(a *Application) http.Handler {
 
 	r.Post("/", root.NewCreateShortHandler(a.baseURL, a.store, a.shortener))
 	r.Post("/api/shorten", shorten.NewShortenHandler(a.baseURL, a.store, a.shortener))
-	r.Post("/api/shorten/batch", batch.NewBatchHandler(a.baseURL, a.store, a.shortener))
+	r.Post("/api/shorten/batch", batch.NewBatchHandler(a.baseURL, a.store, a.shortener, a.dedupe))
 
 	r.Get("/api/user/urls", urls.NewUserURLsHandler(a.baseURL, a.store))
 	r.Delete("/api/user/urls", urls.NewDeleteURLsHandlers(a))
+	r.Get("/api/user/urls/delete/{job}", urls.NewDeleteJobHandler(a))
+	r.Get("/api/user/urls/trash", urls.NewUserTrashHandler(a.baseURL, a.purgeRetention, a.store))
+	r.Post("/api/user/urls/restore", urls.NewRestoreURLsHandler(a.purgeRetention, a.store))
 
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.TrustedSubnet(a.trustedSubnet).Serve)
@@ -54,7 +61,7 @@ func NewRouter(a *Application) http.Handler {
 }
 
 // NewProfRouter создаёт маршрутизатор для профилирования
-func newProfRouter() http.Handler {
+func newProfRouter(a *Application) http.Handler {
 
 	r := chi.NewRouter()
 	r.Use(middleware.Log) // прослойка логирования
@@ -65,6 +72,38 @@ func newProfRouter() http.Handler {
 	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
+	// состояние пула соединений с базой
+	if p, ok := storage.As[handlers.PoolStatsGetter](a.store); ok {
+		r.Get("/debug/pool", stats.NewPoolStatsHandler(p))
+	}
+	// счётчики кеша переходов
+	if c, ok := storage.As[handlers.CacheStatsGetter](a.store); ok {
+		r.Get("/debug/cache", stats.NewCacheStatsHandler(c))
+	}
+	// повторы генерации коротких ссылок
+	if s, ok := a.shortener.(handlers.ShortenerStatsGetter); ok {
+		r.Get("/debug/shortener", stats.NewShortenerStatsHandler(s))
+	}
+
 	return r
 
 }
+
+// Первые сегменты постоянных путей роутера: короткая ссылка
+// с таким именем была бы закрыта путём сервиса
+func routeWords(h http.Handler) []string {
+	routes, ok := h.(chi.Routes)
+	if !ok {
+		return nil
+	}
+
+	var words []string
+	chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		word, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		if word != "" && !strings.ContainsAny(word, "{*") {
+			words = append(words, word)
+		}
+		return nil
+	})
+	return words
+}
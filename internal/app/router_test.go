@@ -359,3 +359,15 @@ func TestRouterHandlerAPIBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestRouteWords(t *testing.T) {
+	words := routeWords(NewRouter(newTestApp(t)))
+	assert.Contains(t, words, "ping")
+	assert.Contains(t, words, "api")
+	for _, w := range words {
+		assert.NotContains(t, w, "{")
+		assert.NotEmpty(t, w)
+	}
+
+	assert.Empty(t, routeWords(http.NotFoundHandler()))
+}
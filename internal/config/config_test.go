@@ -3,6 +3,7 @@ package config
 import (
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,6 +19,10 @@ func TestJsonConfig(t *testing.T) {
 	err = decodeJsonConfigFile(testdata + "/errconf.json")
 	require.Error(t, err)
 
+	// интервалы задаются строкой
+	err = decodeJsonConfigFile(testdata + "/errduration.json")
+	require.Error(t, err)
+
 	err = decodeJsonConfigFile(testdata + "/config.json")
 	require.NoError(t, err)
 
@@ -26,6 +31,19 @@ func TestJsonConfig(t *testing.T) {
 	assert.Equal(t, "/path/to/file.db", config.FileStoragePath)
 	assert.Equal(t, "postgres://", config.DatabaseDSN)
 	assert.Equal(t, true, config.EnableHTTPS)
+	assert.Equal(t, 1000, config.CacheSize)
+	assert.Equal(t, "always", config.FileSyncMode)
+	assert.Equal(t, 2*time.Second, config.FileSyncInterval)
+	assert.Equal(t, "postgres://replica1,postgres://replica2", config.DatabaseReplicas)
+	assert.Equal(t, "exec", config.DatabaseExecMode)
+	assert.Equal(t, time.Minute, config.CacheTTL)
+	assert.Equal(t, 30*time.Second, config.SweepInterval)
+	assert.Equal(t, 720*time.Hour, config.PurgeRetention)
+	assert.Equal(t, 2*time.Hour, config.PurgeInterval)
+	assert.True(t, config.PurgeFree)
+	assert.Equal(t, "random", config.ShortStrategy)
+	assert.Equal(t, 12, config.ShortLength)
+	assert.Equal(t, "user", config.DedupeScope)
 }
 
 func TestConfig(t *testing.T) {
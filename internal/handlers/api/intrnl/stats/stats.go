@@ -8,8 +8,11 @@ import (
 	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/logger"
 	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
 )
 
+// NewStatsHandler статистика хранилища.
+// Если хранилище работает через пул соединений или кеш, в ответ добавляется их состояние.
 func NewStatsHandler(s handlers.StatsGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -24,6 +27,15 @@ func NewStatsHandler(s handlers.StatsGetter) http.HandlerFunc {
 			return
 		}
 
+		if p, ok := storage.As[handlers.PoolStatsGetter](s); ok {
+			pool := p.PoolStats()
+			resp.Pool = &pool
+		}
+		if c, ok := storage.As[handlers.CacheStatsGetter](s); ok {
+			cache := c.CacheStats()
+			resp.Cache = &cache
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 
@@ -33,3 +45,39 @@ func NewStatsHandler(s handlers.StatsGetter) http.HandlerFunc {
 		}
 	}
 }
+
+// NewPoolStatsHandler состояние пула соединений для сбора метрик
+func NewPoolStatsHandler(p handlers.PoolStatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(p.PoolStats()); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+		}
+	}
+}
+
+// NewCacheStatsHandler счётчики кеша для сбора метрик
+func NewCacheStatsHandler(c handlers.CacheStatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(c.CacheStats()); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+		}
+	}
+}
+
+// NewShortenerStatsHandler счётчики сокращателя для сбора метрик
+func NewShortenerStatsHandler(s handlers.ShortenerStatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(s.ShortenerStats()); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package stats
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http/httptest"
@@ -9,6 +10,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/cachestore"
 )
 
 type statsGetterFunc func() (int, int, error)
@@ -77,3 +82,105 @@ func TestStatsHandler(t *testing.T) {
 		})
 	}
 }
+
+type poolStatsGetter struct {
+	statsGetterFunc
+	pool model.PoolStats
+}
+
+func (p poolStatsGetter) PoolStats() model.PoolStats {
+	return p.pool
+}
+
+func TestStatsHandlerPool(t *testing.T) {
+	s := poolStatsGetter{
+		statsGetterFunc: func() (int, int, error) { return 3, 2, nil },
+		pool:            model.PoolStats{MaxConns: 10, TotalConns: 4, AcquiredConns: 1, IdleConns: 3},
+	}
+
+	r := httptest.NewRequest("GET", "/internal/stats", nil)
+	w := httptest.NewRecorder()
+	NewStatsHandler(s).ServeHTTP(w, r)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	var got model.StatsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, 3, got.URLs)
+	assert.Equal(t, 2, got.Users)
+	require.NotNil(t, got.Pool)
+	assert.Equal(t, s.pool, *got.Pool)
+
+	// отдельный ответ для метрик
+	w = httptest.NewRecorder()
+	NewPoolStatsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/debug/pool", nil))
+
+	var pool model.PoolStats
+	require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&pool))
+	assert.Equal(t, s.pool, pool)
+}
+
+// хранилище с пулом соединений, из методов нужна только статистика
+type poolStore struct {
+	storage.Storage
+	pool model.PoolStats
+}
+
+func (p poolStore) Stats(ctx context.Context) (int, int, error) {
+	return 5, 1, nil
+}
+
+func (p poolStore) PoolStats() model.PoolStats {
+	return p.pool
+}
+
+func TestStatsHandlerCache(t *testing.T) {
+	// состояние пула видно и сквозь кеш
+	inner := poolStore{pool: model.PoolStats{MaxConns: 10}}
+	s := cachestore.New(inner, cachestore.WithSize(100))
+
+	r := httptest.NewRequest("GET", "/internal/stats", nil)
+	w := httptest.NewRecorder()
+	NewStatsHandler(s).ServeHTTP(w, r)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	var got model.StatsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, 5, got.URLs)
+	require.NotNil(t, got.Pool)
+	assert.Equal(t, inner.pool, *got.Pool)
+	require.NotNil(t, got.Cache)
+	assert.Equal(t, 100, got.Cache.Capacity)
+
+	w = httptest.NewRecorder()
+	NewCacheStatsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/debug/cache", nil))
+
+	var cache model.CacheStats
+	require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&cache))
+	assert.Equal(t, s.CacheStats(), cache)
+}
+
+type shortenerStats model.ShortenerStats
+
+func (s shortenerStats) ShortenerStats() model.ShortenerStats {
+	return model.ShortenerStats(s)
+}
+
+func TestShortenerStatsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewShortenerStatsHandler(shortenerStats{CollisionRetries: 3}).
+		ServeHTTP(w, httptest.NewRequest("GET", "/debug/shortener", nil))
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"collision_retries":3}`, string(body))
+}
@@ -4,8 +4,10 @@ package batch
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -16,11 +18,13 @@ import (
 	"github.com/eugene982/url-shortener/internal/middleware"
 	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/eugene982/url-shortener/internal/shortener"
+	"github.com/eugene982/url-shortener/internal/storage"
 )
 
 // NewBatchHandler Генерирование короткой ссылки и сохранеине её во временном хранилище
-// из запроса формата JSON
-func NewBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener) http.HandlerFunc {
+// из запроса формата JSON. Повторы адреса в пакете разделяют ссылку
+// в пределах области уникальности scope.
+func NewBatchHandler(baseURL string, u handlers.BatchWriter, s shortener.Shortener, scope storage.DedupeScope) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close() // Очищаем тело
 
@@ -50,6 +54,8 @@ func NewBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener)
 
 		response := make([]model.BatchResponse, 0, len(request)) // подготовка ответа
 		write := make([]model.StoreData, 0, len(request))        // это положим в хранилище
+		generated := make(map[string]string)                     // ключ адреса -> вычисленная ссылка
+		now := time.Now()
 
 		for _, batch := range request {
 
@@ -59,8 +65,22 @@ func NewBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener)
 				http.NotFound(w, r)
 				return
 			}
+			if err := shortener.CheckAlias(s, batch.Alias); err != nil {
+				logger.Warn("request is not valid",
+					"error", err)
+				http.NotFound(w, r)
+				return
+			}
+
+			expiresAt, err := model.Expiry(now, batch.ExpiresAt, time.Duration(batch.TTL)*time.Second)
+			if err != nil {
+				logger.Warn("request is not valid",
+					"error", err)
+				http.NotFound(w, r)
+				return
+			}
 
-			short, err := s.Short(batch.OriginalURL)
+			short, err := shortURL(s, generated, scope, userID, batch.OriginalURL, batch.Alias)
 			if err != nil {
 				logger.Warn("error get short url",
 					"error", err)
@@ -70,7 +90,6 @@ func NewBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener)
 
 			response = append(response, model.BatchResponse{
 				CorrelationID: batch.CorrelationID,
-				ShortURL:      baseURL + short,
 			})
 
 			write = append(write, model.StoreData{
@@ -78,15 +97,31 @@ func NewBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener)
 				UserID:      userID,
 				ShortURL:    short,
 				OriginalURL: batch.OriginalURL,
+				ExpiresAt:   expiresAt,
 			})
 		}
 
-		if err = u.Update(r.Context(), write); err != nil {
+		aliases := make([]string, len(request))
+		for i, batch := range request {
+			aliases[i] = batch.Alias
+		}
+
+		err = writeBatch(r.Context(), u, s, aliases, write)
+		if errors.Is(err, storage.ErrAddressConflict) {
+			logger.Warn(err.Error())
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
 			logger.Error(fmt.Errorf("error write data in storage: %w", err))
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		// ссылки могли быть заменены сохранёнными
+		for i := range response {
+			response[i].ShortURL = baseURL + write[i].ShortURL
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 
@@ -99,16 +134,33 @@ func NewBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener)
 }
 
 // NewGRPCBatchHandler генерирование короткой ссылки из набора grpc
-func NewGRPCBatchHandler(baseURL string, u handlers.Updater, s shortener.Shortener) handlers.BatchShortHandler {
+func NewGRPCBatchHandler(baseURL string, u handlers.BatchWriter, s shortener.Shortener, scope storage.DedupeScope) handlers.BatchShortHandler {
 	return func(ctx context.Context, in *proto.BatchRequest) (*proto.BatchResponse, error) {
 		var response proto.BatchResponse
 
 		write := make([]model.StoreData, 0, len(in.Request)) // это положим в хранилище
+		aliases := make([]string, 0, len(in.Request))
+		generated := make(map[string]string) // ключ адреса -> вычисленная ссылка
+		now := time.Now()
 
 		for _, batch := range in.Request {
 			var err error
 
-			short, err := s.Short(batch.OriginalUrl)
+			expiresAt, err := handlers.ProtoExpiry(now, batch.ExpiresAt, batch.Ttl)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			if batch.Alias != "" {
+				if err = model.ValidateAlias(batch.Alias); err != nil {
+					return nil, status.Error(codes.InvalidArgument, err.Error())
+				}
+				if err = shortener.CheckAlias(s, batch.Alias); err != nil {
+					return nil, status.Error(codes.InvalidArgument, err.Error())
+				}
+			}
+			aliases = append(aliases, batch.Alias)
+
+			short, err := shortURL(s, generated, scope, in.User, batch.OriginalUrl, batch.Alias)
 			if err != nil {
 				logger.Warn("error get short url",
 					"error", err)
@@ -117,7 +169,6 @@ func NewGRPCBatchHandler(baseURL string, u handlers.Updater, s shortener.Shorten
 
 			response.Responce = append(response.Responce, &proto.BatchResponse_Batch{
 				CorrelationId: batch.CorrelationId,
-				ShortUrl:      baseURL + short,
 			})
 
 			write = append(write, model.StoreData{
@@ -125,14 +176,245 @@ func NewGRPCBatchHandler(baseURL string, u handlers.Updater, s shortener.Shorten
 				UserID:      in.User,
 				ShortURL:    short,
 				OriginalURL: batch.OriginalUrl,
+				ExpiresAt:   expiresAt,
 			})
 		}
 
-		if err := u.Update(ctx, write); err != nil {
+		err := writeBatch(ctx, u, s, aliases, write)
+		if errors.Is(err, storage.ErrAddressConflict) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		} else if err != nil {
 			logger.Error(fmt.Errorf("error write data in storage: %w", err))
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 
+		for i, batch := range response.Responce {
+			batch.ShortUrl = baseURL + write[i].ShortURL
+		}
+
 		return &response, nil
 	}
 }
+
+// Короткая ссылка: желаемая или вычисленная по адресу.
+// Повтор адреса в области уникальности получает ту же вычисленную ссылку,
+// иначе случайная стратегия заняла бы адрес дважды.
+// Без уникальности каждый повтор сокращается заново.
+func shortURL(s shortener.Shortener, generated map[string]string, scope storage.DedupeScope,
+	userID, addr, alias string) (string, error) {
+	if alias != "" {
+		return alias, nil
+	}
+	key, dedupe := scope.OriginKey(userID, addr)
+	if short, ok := generated[key]; dedupe && ok {
+		return short, nil
+	}
+
+	short, err := s.Short(addr)
+	if err != nil {
+		return "", err
+	}
+	if dedupe {
+		generated[key] = short
+	}
+	return short, nil
+}
+
+// Запись пакета. Вычисленная ссылка, занятая другим адресом в пакете
+// или в хранилище, заменяется запасной, не больше handlers.ShortAttempts попыток.
+// Если адрес уже сокращён другой ссылкой, вычисленная заменяется сохранённой.
+func writeBatch(ctx context.Context, u handlers.BatchWriter, s shortener.Shortener, aliases []string, write []model.StoreData) error {
+	if err := checkAliases(ctx, u, aliases, write); err != nil {
+		return err
+	}
+
+	// желаемые и сохранённые ссылки не заменяются
+	fixed := make([]bool, len(write))
+	for i, alias := range aliases {
+		fixed[i] = alias != ""
+	}
+	attempts := make([]int, len(write))
+	reused := false
+
+	for {
+		if err := batchCollisions(s, fixed, attempts, write); err != nil {
+			return err
+		}
+
+		err := u.Update(ctx, write)
+		switch {
+		case errors.Is(err, storage.ErrShortConflict):
+			retry, rerr := storeCollisions(ctx, u, s, fixed, attempts, write)
+			if rerr != nil {
+				return rerr
+			} else if !retry {
+				return err
+			}
+
+		case errors.Is(err, storage.ErrAddressConflict) && !reused:
+			reused = true
+			replaced, rerr := reuseStored(ctx, u, fixed, write)
+			if rerr != nil {
+				return rerr
+			} else if !replaced {
+				return err
+			}
+
+		default:
+			return err
+		}
+	}
+}
+
+// Замена вычисленных ссылок, совпавших в пакете со ссылкой другого адреса
+func batchCollisions(s shortener.Shortener, fixed []bool, attempts []int, write []model.StoreData) error {
+	for {
+		owners := make(map[string]string, len(write)) // короткая ссылка -> адрес
+		for i, d := range write {
+			if fixed[i] {
+				owners[d.ShortURL] = d.OriginalURL
+			}
+		}
+
+		collided := false
+		for i, d := range write {
+			if fixed[i] {
+				continue
+			}
+			if origin, ok := owners[d.ShortURL]; ok && origin != d.OriginalURL {
+				if err := nextShort(s, fixed, attempts, write, i); err != nil {
+					return err
+				}
+				collided = true
+				continue
+			}
+			owners[d.ShortURL] = d.OriginalURL
+		}
+		if !collided {
+			return nil
+		}
+	}
+}
+
+// Замена вычисленных ссылок, занятых в хранилище другим адресом
+// или тем же адресом другого пользователя, если адреса уникальны
+// не на весь сервис. Возвращает true, если хоть одна ссылка заменена.
+func storeCollisions(ctx context.Context, g handlers.AddrGetter, s shortener.Shortener,
+	fixed []bool, attempts []int, write []model.StoreData) (bool, error) {
+
+	var replaced bool
+	for i, d := range write {
+		if fixed[i] {
+			continue
+		}
+
+		data, err := g.GetAddr(ctx, d.ShortURL)
+		if errors.Is(err, storage.ErrAddressNotFound) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if data.OriginalURL == d.OriginalURL && (data.UserID == d.UserID || sharedShort(ctx, g, d, data.ShortURL)) {
+			continue
+		}
+		if err = nextShort(s, fixed, attempts, write, i); err != nil {
+			return false, err
+		}
+		replaced = true
+	}
+	return replaced, nil
+}
+
+// Ссылка на тот же адрес другого пользователя принадлежит и строке d,
+// если адреса уникальны на весь сервис
+func sharedShort(ctx context.Context, g handlers.AddrGetter, d model.StoreData, short string) bool {
+	og, ok := storage.As[storage.OriginGetter](g)
+	if !ok {
+		return true
+	}
+	data, err := og.GetByOrigin(ctx, d.UserID, d.OriginalURL)
+	return err == nil && data.ShortURL == short
+}
+
+// Запасная ссылка для адреса строки i и его повторов в пакете
+func nextShort(s shortener.Shortener, fixed []bool, attempts []int, write []model.StoreData, i int) error {
+	attempt := attempts[i] + 1
+	if attempt >= handlers.ShortAttempts {
+		return storage.ErrShortConflict
+	}
+
+	addr := write[i].OriginalURL
+	short, err := shortener.Retry(s, addr, attempt)
+	if err != nil {
+		return err
+	}
+	for j := range write {
+		if !fixed[j] && write[j].OriginalURL == addr {
+			write[j].ShortURL = short
+			attempts[j] = attempt
+		}
+	}
+	return nil
+}
+
+// Замена вычисленных ссылок пакета на сохранённые для уже сокращённых адресов.
+// Возвращает true, если хоть одна ссылка заменена.
+func reuseStored(ctx context.Context, u handlers.BatchWriter, fixed []bool, write []model.StoreData) (bool, error) {
+	g, ok := storage.As[storage.OriginGetter](u)
+	if !ok {
+		return false, nil
+	}
+
+	var replaced bool
+	for i, d := range write {
+		if fixed[i] {
+			continue
+		}
+
+		data, err := g.GetByOrigin(ctx, d.UserID, d.OriginalURL)
+		if errors.Is(err, storage.ErrAddressNotFound) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if data.ShortURL != d.ShortURL {
+			write[i].ShortURL = data.ShortURL
+			replaced = true
+		}
+		fixed[i] = true
+	}
+	return replaced, nil
+}
+
+// Проверка желаемых коротких ссылок пакета перед записью.
+// Запись пакета заменяет ссылки, поэтому псевдоним должен быть свободен
+// или уже указывать на тот же адрес того же пользователя.
+// aliases[i] - желаемая ссылка write[i] или пустая строка.
+func checkAliases(ctx context.Context, g handlers.AddrGetter, aliases []string, write []model.StoreData) error {
+	seen := make(map[string]string)
+	for i, d := range write {
+		if aliases[i] == "" {
+			continue
+		}
+
+		// повтор псевдонима в пакете допустим только для того же адреса
+		if origin, ok := seen[d.ShortURL]; ok {
+			if origin != d.OriginalURL {
+				return storage.ErrShortConflict
+			}
+			continue
+		}
+		seen[d.ShortURL] = d.OriginalURL
+
+		data, err := g.GetAddr(ctx, d.ShortURL)
+		if errors.Is(err, storage.ErrAddressNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if data.OriginalURL != d.OriginalURL || data.UserID != d.UserID {
+			return storage.ErrShortConflict
+		}
+	}
+	return nil
+}
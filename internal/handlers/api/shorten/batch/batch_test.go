@@ -3,14 +3,26 @@ package batch
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
+	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/middleware"
 	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/shortener"
+	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/memstore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -21,6 +33,10 @@ func (f updaterFunc) Update(ctx context.Context, list []model.StoreData) error {
 	return f()
 }
 
+func (f updaterFunc) GetAddr(context.Context, string) (model.StoreData, error) {
+	return model.StoreData{}, storage.ErrAddressNotFound
+}
+
 type shortenerFunc func(string) (string, error)
 
 func (f shortenerFunc) Short(s string) (string, error) {
@@ -97,7 +113,7 @@ func TestBatchHandler(t *testing.T) {
 			ru := middleware.RequestWithUserID(r, "user")
 
 			NewBatchHandler(base, updaterFunc(updater),
-				shortenerFunc(shorten)).ServeHTTP(w, ru)
+				shortenerFunc(shorten), storage.DedupeGlobal).ServeHTTP(w, ru)
 			resp := w.Result()
 
 			defer resp.Body.Close()
@@ -222,7 +238,7 @@ func TestGRPCBatchHandler(t *testing.T) {
 				return tt.want.err
 			})
 
-			resp, err := NewGRPCBatchHandler(base, updater, shorten)(context.TODO(), tt.request)
+			resp, err := NewGRPCBatchHandler(base, updater, shorten, storage.DedupeGlobal)(context.TODO(), tt.request)
 			if tt.want.err != nil {
 				assert.Error(t, err)
 				return
@@ -235,3 +251,321 @@ func TestGRPCBatchHandler(t *testing.T) {
 		})
 	}
 }
+
+type listUpdaterFunc func([]model.StoreData) error
+
+func (f listUpdaterFunc) Update(ctx context.Context, list []model.StoreData) error {
+	return f(list)
+}
+
+func (f listUpdaterFunc) GetAddr(context.Context, string) (model.StoreData, error) {
+	return model.StoreData{}, storage.ErrAddressNotFound
+}
+
+func TestBatchExpiry(t *testing.T) {
+	var stored []model.StoreData
+	updater := listUpdaterFunc(func(list []model.StoreData) error {
+		stored = list
+		return nil
+	})
+	shorten := shortenerFunc(func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	})
+
+	body := `[
+		{"correlation_id":"1","original_url":"ya.ru","ttl":60},
+		{"correlation_id":"2","original_url":"go.dev","expires_at":"2100-01-01T00:00:00Z"},
+		{"correlation_id":"3","original_url":"golang.org"}
+	]`
+	r := httptest.NewRequest("POST", "/api/shorten/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	NewBatchHandler("/", updater, shorten, storage.DedupeGlobal).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, 201, resp.StatusCode)
+	require.Len(t, stored, 3)
+	require.NotNil(t, stored[0].ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *stored[0].ExpiresAt, 10*time.Second)
+	require.NotNil(t, stored[1].ExpiresAt)
+	assert.True(t, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC).Equal(*stored[1].ExpiresAt))
+	assert.Nil(t, stored[2].ExpiresAt)
+
+	// gRPC
+	stored = nil
+	_, err := NewGRPCBatchHandler("/", updater, shorten, storage.DedupeGlobal)(context.Background(), &proto.BatchRequest{
+		User: "user",
+		Request: []*proto.BatchRequest_Batch{
+			{CorrelationId: "1", OriginalUrl: "ya.ru", Ttl: durationpb.New(time.Minute)},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.NotNil(t, stored[0].ExpiresAt)
+
+	_, err = NewGRPCBatchHandler("/", updater, shorten, storage.DedupeGlobal)(context.Background(), &proto.BatchRequest{
+		User: "user",
+		Request: []*proto.BatchRequest_Batch{
+			{
+				CorrelationId: "1",
+				OriginalUrl:   "ya.ru",
+				Ttl:           durationpb.New(time.Minute),
+				ExpiresAt:     timestamppb.New(time.Now().Add(time.Hour)),
+			},
+		},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestBatchAliases(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set(context.Background(),
+		model.StoreData{UserID: "other", ShortURL: "taken", OriginalURL: "go.dev"}))
+
+	// желаемые ссылки проверяются фильтром сокращателя
+	shorten := shortener.NewFiltered(shortenerFunc(func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}), shortener.NewFilter([]string{"spam"}))
+
+	tests := []struct {
+		name string
+		body string
+		code int
+		want string
+	}{
+		{
+			name: "alias",
+			body: `[{"correlation_id":"1","original_url":"ya.ru","alias":"spring-sale"},
+				{"correlation_id":"2","original_url":"mail.ru"}]`,
+			code: http.StatusCreated,
+			want: `[{"correlation_id":"1","short_url":"/spring-sale"},
+				{"correlation_id":"2","short_url":"/MAIL.RU"}]`,
+		},
+		{
+			name: "same alias again",
+			body: `[{"correlation_id":"1","original_url":"ya.ru","alias":"spring-sale"}]`,
+			code: http.StatusCreated,
+			want: `[{"correlation_id":"1","short_url":"/spring-sale"}]`,
+		},
+		{
+			name: "taken",
+			body: `[{"correlation_id":"1","original_url":"bing.com","alias":"taken"}]`,
+			code: http.StatusConflict,
+		},
+		{
+			name: "twice in batch",
+			body: `[{"correlation_id":"1","original_url":"a.ru","alias":"twice"},
+				{"correlation_id":"2","original_url":"b.ru","alias":"twice"}]`,
+			code: http.StatusConflict,
+		},
+		{
+			name: "reserved",
+			body: `[{"correlation_id":"1","original_url":"bing.com","alias":"api"}]`,
+			code: http.StatusNotFound,
+		},
+		{
+			name: "blocked",
+			body: `[{"correlation_id":"1","original_url":"bing.com","alias":"nospam"}]`,
+			code: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/shorten/batch", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			NewBatchHandler("/", store, shorten, storage.DedupeGlobal).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+		})
+	}
+
+	// gRPC
+	_, err = NewGRPCBatchHandler("/", store, shorten, storage.DedupeGlobal)(context.Background(), &proto.BatchRequest{
+		User:    "user",
+		Request: []*proto.BatchRequest_Batch{{CorrelationId: "1", OriginalUrl: "bing.com", Alias: "taken"}},
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = NewGRPCBatchHandler("/", store, shorten, storage.DedupeGlobal)(context.Background(), &proto.BatchRequest{
+		User:    "user",
+		Request: []*proto.BatchRequest_Batch{{CorrelationId: "1", OriginalUrl: "bing.com", Alias: "a b"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = NewGRPCBatchHandler("/", store, shorten, storage.DedupeGlobal)(context.Background(), &proto.BatchRequest{
+		User:    "user",
+		Request: []*proto.BatchRequest_Batch{{CorrelationId: "1", OriginalUrl: "bing.com", Alias: "spam-sale"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestBatchStoredShorts(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Set(context.Background(),
+		model.StoreData{UserID: "user", ShortURL: "stored", OriginalURL: "ya.ru"}))
+
+	// каждый вызов даёт новую ссылку, как случайная стратегия
+	var n int
+	shorten := shortenerFunc(func(string) (string, error) {
+		n++
+		return fmt.Sprintf("gen%d", n), nil
+	})
+
+	body := `[{"correlation_id":"1","original_url":"ya.ru"},
+		{"correlation_id":"2","original_url":"go.dev"},
+		{"correlation_id":"3","original_url":"go.dev"}]`
+	r := httptest.NewRequest("POST", "/api/shorten/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	NewBatchHandler("/", store, shorten, storage.DedupeGlobal).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"correlation_id":"1","short_url":"/stored"},
+		{"correlation_id":"2","short_url":"/gen2"},
+		{"correlation_id":"3","short_url":"/gen2"}]`, string(got))
+
+	// gRPC
+	res, err := NewGRPCBatchHandler("/", store, shorten, storage.DedupeGlobal)(context.Background(), &proto.BatchRequest{
+		User: "user",
+		Request: []*proto.BatchRequest_Batch{
+			{CorrelationId: "1", OriginalUrl: "go.dev"},
+			{CorrelationId: "2", OriginalUrl: "bing.com"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, res.Responce, 2)
+	assert.Equal(t, "/gen2", res.Responce[0].ShortUrl)
+	assert.Equal(t, "/gen4", res.Responce[1].ShortUrl)
+}
+
+func TestBatchNoDedupe(t *testing.T) {
+	store, err := memstore.New("", memstore.WithDedupe(storage.DedupeNone))
+	require.NoError(t, err)
+	defer store.Close()
+
+	var n int
+	shorten := shortenerFunc(func(string) (string, error) {
+		n++
+		return fmt.Sprintf("gen%d", n), nil
+	})
+
+	// без уникальности повтор адреса получает свою ссылку
+	body := `[{"correlation_id":"1","original_url":"go.dev"},
+		{"correlation_id":"2","original_url":"go.dev"}]`
+	r := httptest.NewRequest("POST", "/api/shorten/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	NewBatchHandler("/", store, shorten, storage.DedupeNone).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"correlation_id":"1","short_url":"/gen1"},
+		{"correlation_id":"2","short_url":"/gen2"}]`, string(got))
+
+	list, err := store.GetUserURLs(context.Background(), "user")
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
+
+func TestBatchCollisions(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	taken := model.StoreData{UserID: "other", ShortURL: "taken", OriginalURL: "go.dev"}
+	require.NoError(t, store.Set(context.Background(), taken))
+
+	// ссылки по адресу и номеру попытки, попытки различаются солью
+	shorts := map[string][]string{
+		"ya.ru":    {"taken", "ya1"},            // занята в хранилище
+		"mail.ru":  {"same", "mail1"},           // совпала с другим адресом пакета
+		"bing.com": {"same"},                    // первой заняла ссылку в пакете
+		"spam.ru":  {"taken", "taken", "taken"}, // свободной не нашлось
+	}
+	calls := make(map[string]int)
+	shorten := shortenerFunc(func(s string) (string, error) {
+		addr, _, _ := strings.Cut(s, "\x00")
+		list := shorts[addr]
+		short := list[len(list)-1]
+		if n := calls[addr]; n < len(list) {
+			short = list[n]
+		}
+		calls[addr]++
+		return short, nil
+	})
+
+	tests := []struct {
+		name string
+		body string
+		code int
+		want string
+	}{
+		{
+			name: "resolved",
+			body: `[{"correlation_id":"1","original_url":"bing.com"},
+				{"correlation_id":"2","original_url":"mail.ru"},
+				{"correlation_id":"3","original_url":"ya.ru"},
+				{"correlation_id":"4","original_url":"ya.ru"}]`,
+			code: http.StatusCreated,
+			want: `[{"correlation_id":"1","short_url":"/same"},
+				{"correlation_id":"2","short_url":"/mail1"},
+				{"correlation_id":"3","short_url":"/ya1"},
+				{"correlation_id":"4","short_url":"/ya1"}]`,
+		},
+		{
+			name: "exhausted",
+			body: `[{"correlation_id":"1","original_url":"spam.ru"}]`,
+			code: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/shorten/batch", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			NewBatchHandler("/", store, shorten, storage.DedupeGlobal).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.want != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.want, string(body))
+			}
+
+			// занятая ссылка не перезаписана
+			get, err := store.GetAddr(context.Background(), "taken")
+			require.NoError(t, err)
+			assert.Equal(t, taken.OriginalURL, get.OriginalURL)
+		})
+	}
+	assert.Equal(t, handlers.ShortAttempts, calls["spam.ru"])
+}
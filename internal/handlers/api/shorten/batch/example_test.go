@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/eugene982/url-shortener/internal/middleware"
+	"github.com/eugene982/url-shortener/internal/storage"
 )
 
 func ExampleNewBatchHandler() {
@@ -21,7 +22,7 @@ func ExampleNewBatchHandler() {
 		return strings.ToUpper(s), nil
 	})
 
-	handler := NewBatchHandler(base, updater, shorten)
+	handler := NewBatchHandler(base, updater, shorten, storage.DedupeGlobal)
 
 	reqbody := strings.NewReader(`[{"correlation_id":"1", "original_url":"ya.ru"}]`)
 	r := httptest.NewRequest("POST", "/api/shorten/batch", reqbody)
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/logger"
@@ -41,15 +42,38 @@ func NewShortenHandler(baseURL string, setter handlers.Setter, sh shortener.Shor
 			http.NotFound(w, r)
 			return
 		}
+		if err := shortener.CheckAlias(sh, request.Alias); err != nil {
+			logger.Warn("request is not valid",
+				"error", err)
+			http.NotFound(w, r)
+			return
+		}
+
+		expiresAt, err := model.Expiry(time.Now(), request.ExpiresAt, time.Duration(request.TTL)*time.Second)
+		if err != nil {
+			logger.Warn("request is not valid",
+				"error", err)
+			http.NotFound(w, r)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 
 		//	подготовка ответа
-		short, err := handlers.GetAndWriteShort(sh, setter, request.URL, r)
+		short, err := handlers.GetAndWriteShort(sh, setter, request.URL, request.Alias, expiresAt, r)
 
 		if err == nil {
 			w.WriteHeader(http.StatusCreated)
 
+		} else if errors.Is(err, storage.ErrShortConflict) ||
+			request.Alias != "" && errors.Is(err, storage.ErrAddressConflict) {
+			// занятая короткая ссылка указывает на другой адрес, отдавать её нельзя
+			logger.Warn(err.Error(),
+				"url", request.URL,
+				"alias", request.Alias)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+
 		} else if errors.Is(err, storage.ErrAddressConflict) {
 			logger.Warn(err.Error(),
 				"url", request.URL)
@@ -2,13 +2,20 @@ package shorten
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/eugene982/url-shortener/internal/middleware"
 	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/shortener"
+	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/memstore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -66,6 +73,26 @@ func TestRouterHandlerApiShorten(t *testing.T) {
 			req:  req{`{"url":"yandex.ru"}`, "application/json;charset=utf-8"},
 			want: want{201, `{"result":"/yandex.ru"}`},
 		},
+		{
+			name: "request with ttl",
+			req:  req{`{"url":"ya.ru","ttl":60}`, "application/json"},
+			want: want{201, `{"result":"/ya.ru"}`},
+		},
+		{
+			name: "request with ttl and expires_at",
+			req:  req{`{"url":"ya.ru","ttl":60,"expires_at":"2100-01-01T00:00:00Z"}`, "application/json"},
+			want: want{404, "404 page not found\n"},
+		},
+		{
+			name: "request with negative ttl",
+			req:  req{`{"url":"ya.ru","ttl":-1}`, "application/json"},
+			want: want{404, "404 page not found\n"},
+		},
+		{
+			name: "request expired",
+			req:  req{`{"url":"ya.ru","expires_at":"2000-01-01T00:00:00Z"}`, "application/json"},
+			want: want{404, "404 page not found\n"},
+		},
 		// ...
 	}
 
@@ -108,3 +135,196 @@ func TestRouterHandlerApiShorten(t *testing.T) {
 		})
 	}
 }
+
+type dataSetterFunc func(model.StoreData) error
+
+func (f dataSetterFunc) Set(ctx context.Context, data model.StoreData) error {
+	return f(data)
+}
+
+func TestShortenExpiry(t *testing.T) {
+	expiresAt := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body string
+		want func(t *testing.T, got *time.Time)
+	}{
+		{"none", `{"url":"ya.ru"}`, func(t *testing.T, got *time.Time) {
+			assert.Nil(t, got)
+		}},
+		{"expires_at", `{"url":"ya.ru","expires_at":"2100-01-01T03:00:00+03:00"}`, func(t *testing.T, got *time.Time) {
+			require.NotNil(t, got)
+			assert.True(t, expiresAt.Equal(*got))
+		}},
+		{"ttl", `{"url":"ya.ru","ttl":3600}`, func(t *testing.T, got *time.Time) {
+			require.NotNil(t, got)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), *got, time.Minute)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored model.StoreData
+			setter := dataSetterFunc(func(d model.StoreData) error {
+				stored = d
+				return nil
+			})
+			shortener := shortenerFunc(func(s string) (string, error) {
+				return s, nil
+			})
+
+			r := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			NewShortenHandler("/", setter, shortener).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, 201, resp.StatusCode)
+			tt.want(t, stored.ExpiresAt)
+		})
+	}
+}
+
+func TestShortenAlias(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		err   error
+		code  int
+		short string
+	}{
+		{"alias", `{"url":"ya.ru","alias":"spring-sale"}`, nil, http.StatusCreated, "spring-sale"},
+		{"no alias", `{"url":"ya.ru"}`, nil, http.StatusCreated, "ya.ru"},
+		{"alias taken", `{"url":"ya.ru","alias":"spring-sale"}`, storage.ErrShortConflict, http.StatusConflict, "spring-sale"},
+		{"url taken", `{"url":"ya.ru","alias":"spring-sale"}`, storage.ErrAddressConflict, http.StatusConflict, "spring-sale"},
+		{"reserved", `{"url":"ya.ru","alias":"ping"}`, nil, http.StatusNotFound, ""},
+		{"invalid", `{"url":"ya.ru","alias":"spring sale"}`, nil, http.StatusNotFound, ""},
+		{"blocked", `{"url":"ya.ru","alias":"nospam"}`, nil, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored model.StoreData
+			setter := dataSetterFunc(func(d model.StoreData) error {
+				stored = d
+				return tt.err
+			})
+			// желаемые ссылки проверяются тем же фильтром
+			sh := shortener.NewFiltered(shortenerFunc(func(s string) (string, error) {
+				return s, nil
+			}), shortener.NewFilter([]string{"spam"}))
+
+			r := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			NewShortenHandler("/", setter, sh).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			assert.Equal(t, tt.short, stored.ShortURL)
+			if tt.code != http.StatusCreated {
+				return
+			}
+
+			var res model.ResponseShorten
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			assert.Equal(t, "/"+tt.short, res.Result)
+		})
+	}
+}
+
+func TestShortenStoredShort(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	random, err := shortener.NewRandomShortener()
+	require.NoError(t, err)
+	handler := NewShortenHandler("/", store, random)
+
+	shorten := func() (int, string) {
+		r := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(`{"url":"http://ya.ru"}`))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		var res model.ResponseShorten
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp.StatusCode, res.Result
+	}
+
+	code, first := shorten()
+	require.Equal(t, http.StatusCreated, code)
+
+	// повторное сокращение отдаёт сохранённую ссылку, а не новую случайную
+	code, second := shorten()
+	require.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, first, second)
+}
+
+func TestShortenCollision(t *testing.T) {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	defer store.Close()
+
+	taken := model.StoreData{UserID: "other", ShortURL: "taken", OriginalURL: "http://go.dev"}
+	require.NoError(t, store.Set(context.Background(), taken))
+
+	// выдаёт ссылки по очереди, последняя повторяется
+	queue := func(shorts ...string) shortener.Shortener {
+		return shortenerFunc(func(string) (string, error) {
+			short := shorts[0]
+			if len(shorts) > 1 {
+				shorts = shorts[1:]
+			}
+			return short, nil
+		})
+	}
+
+	tests := []struct {
+		name    string
+		sh      shortener.Shortener
+		code    int
+		short   string
+		retries int64
+	}{
+		{"free", queue("free"), http.StatusCreated, "/free", 0},
+		{"retry", queue("taken", "taken", "retry"), http.StatusCreated, "/retry", 2},
+		{"exhausted", queue("taken"), http.StatusConflict, "", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := shortener.NewMetered(tt.sh)
+
+			body := fmt.Sprintf(`{"url":"http://%s.ru"}`, tt.name)
+			r := httptest.NewRequest("POST", "/api/shorten", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			NewShortenHandler("/", store, sh).ServeHTTP(w, middleware.RequestWithUserID(r, "user"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			assert.Equal(t, tt.retries, sh.ShortenerStats().CollisionRetries)
+			if tt.code == http.StatusCreated {
+				var res model.ResponseShorten
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+				assert.Equal(t, tt.short, res.Result)
+			}
+
+			// занятая ссылка не перезаписана
+			get, err := store.GetAddr(context.Background(), "taken")
+			require.NoError(t, err)
+			assert.Equal(t, taken.OriginalURL, get.OriginalURL)
+		})
+	}
+}
@@ -3,18 +3,26 @@ package urls
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
-	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
 	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/logger"
 	"github.com/eugene982/url-shortener/internal/middleware"
+	"github.com/eugene982/url-shortener/internal/model"
 )
 
+// путь состояния задачи удаления
+const deleteJobPath = "/api/user/urls/delete/"
+
 // NewDeleteURLsHandlers эндпоинт удаление ссылок пользователя.
-// Асинхронный.
+// Асинхронный, возвращает идентификатор задачи удаления.
 func NewDeleteURLsHandlers(d handlers.UserShortAsyncDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close() // Очищаем тело
@@ -43,17 +51,90 @@ func NewDeleteURLsHandlers(d handlers.UserShortAsyncDeleter) http.HandlerFunc {
 			return
 		}
 
-		d.DeleteUserShortAsync(userID, request)
+		jobID, err := d.DeleteUserShortAsync(userID, request)
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", deleteJobPath+jobID)
 		w.WriteHeader(http.StatusAccepted)
+
+		if err := json.NewEncoder(w).Encode(model.DeleteJobResponse{JobID: jobID}); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+		}
+	}
+}
+
+// NewDeleteJobHandler эндпоинт состояния задачи удаления ссылок пользователя
+func NewDeleteJobHandler(g handlers.DeleteJobGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close() // Очищаем тело
+
+		// Получаем идентификатор пользователя из контекста
+		userID, err := middleware.GetUserID(r.Context())
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		job, ok := g.DeleteJob(userID, chi.URLParam(r, "job"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(job); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 }
 
 // NewGRPCDeleteURLsHandlers асинхронное удаление ссылок пользователя
 func NewGRPCDeleteURLsHandlers(d handlers.UserShortAsyncDeleter) handlers.DelUserURLsHandler {
 
-	return func(ctx context.Context, in *proto.DelUserURLsRequest) (*empty.Empty, error) {
-		d.DeleteUserShortAsync(in.User, in.ShortUrl)
-		return &empty.Empty{}, nil
+	return func(ctx context.Context, in *proto.DelUserURLsRequest) (*proto.DelUserURLsResponse, error) {
+		jobID, err := d.DeleteUserShortAsync(in.User, in.ShortUrl)
+		if err != nil {
+			logger.Error(err)
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return &proto.DelUserURLsResponse{JobId: jobID}, nil
+	}
+}
+
+// NewGRPCDeleteJobHandler состояние задачи удаления ссылок пользователя
+func NewGRPCDeleteJobHandler(g handlers.DeleteJobGetter) handlers.GetDeleteJobHandler {
+	return func(ctx context.Context, in *proto.DeleteJobRequest) (*proto.DeleteJobResponse, error) {
+		job, ok := g.DeleteJob(in.User, in.JobId)
+		if !ok {
+			return nil, status.Error(codes.NotFound, "job not found")
+		}
+
+		response := proto.DeleteJobResponse{
+			JobId:     job.ID,
+			Status:    string(job.Status),
+			Error:     job.Error,
+			Results:   make([]*proto.DeleteJobResponse_Result, len(job.Results)),
+			CreatedAt: timestamppb.New(job.CreatedAt),
+		}
+		for i, res := range job.Results {
+			response.Results[i] = &proto.DeleteJobResponse_Result{
+				ShortUrl: res.ShortURL,
+				Status:   string(res.Status),
+			}
+		}
+		if job.FinishedAt != nil {
+			response.FinishedAt = timestamppb.New(*job.FinishedAt)
+		}
+		return &response, nil
 	}
 }
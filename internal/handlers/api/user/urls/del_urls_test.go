@@ -0,0 +1,116 @@
+package urls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/middleware"
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// задачи удаления в памяти
+type mokDeleter struct {
+	jobs map[string]model.DeleteJob
+	err  error
+}
+
+func (m *mokDeleter) DeleteUserShortAsync(userID string, shorts []string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	id := "job" + userID
+	m.jobs[id] = model.DeleteJob{ID: id, UserID: userID, ShortURLs: shorts, Status: model.DeleteJobPending}
+	return id, nil
+}
+
+func (m *mokDeleter) DeleteJob(userID, jobID string) (model.DeleteJob, bool) {
+	job, ok := m.jobs[jobID]
+	return job, ok && job.UserID == userID
+}
+
+func TestDeleteURLsHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		code int
+	}{
+		{"accepted", `["s1","s2"]`, nil, http.StatusAccepted},
+		{"wrong body", `{}`, nil, http.StatusNotFound},
+		{"queue full", `["s1"]`, errors.New("delete queue is full"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &mokDeleter{jobs: make(map[string]model.DeleteJob), err: tt.err}
+
+			r := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			NewDeleteURLsHandlers(d).ServeHTTP(w, middleware.RequestWithUserID(r, "u1"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.code != http.StatusAccepted {
+				return
+			}
+
+			var res model.DeleteJobResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			assert.Equal(t, "jobu1", res.JobID)
+			assert.Equal(t, "/api/user/urls/delete/jobu1", resp.Header.Get("Location"))
+			assert.Equal(t, []string{"s1", "s2"}, d.jobs[res.JobID].ShortURLs)
+		})
+	}
+}
+
+func TestDeleteJobHandler(t *testing.T) {
+	d := &mokDeleter{jobs: map[string]model.DeleteJob{
+		"job1": {ID: "job1", UserID: "u1", Status: model.DeleteJobDone,
+			Results: []model.DeleteURLResult{{ShortURL: "s1", Status: model.DeleteURLDeleted}}},
+	}}
+
+	tests := []struct {
+		name string
+		user string
+		job  string
+		code int
+	}{
+		{"done", "u1", "job1", http.StatusOK},
+		{"other user", "u2", "job1", http.StatusNotFound},
+		{"unknown", "u1", "job2", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/urls/delete/"+tt.job, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("job", tt.job)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			NewDeleteJobHandler(d).ServeHTTP(w, middleware.RequestWithUserID(r, tt.user))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var job model.DeleteJob
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+			assert.Equal(t, model.DeleteJobDone, job.Status)
+			assert.Len(t, job.Results, 1)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package urls
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/eugene982/url-shortener/gen/go/proto/v1"
+	"github.com/eugene982/url-shortener/internal/handlers"
+	"github.com/eugene982/url-shortener/internal/logger"
+	"github.com/eugene982/url-shortener/internal/middleware"
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// NewUserTrashHandler эндпоинт получения удалённых ссылок пользователя,
+// которые ещё можно восстановить. retention - срок хранения удалённых, 0 - бессрочно.
+func NewUserTrashHandler(baseURL string, retention time.Duration, u handlers.UserURLGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close() // Очищаем тело
+
+		// Получаем идентификатор пользователя из контекста
+		userID, err := middleware.GetUserID(r.Context())
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		urls, err := userTrash(r.Context(), u, userID, retention)
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(urls) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		responce := make([]model.TrashURLResponse, len(urls))
+		for i, v := range urls {
+			responce[i] = model.TrashURLResponse{
+				ShortURL:    baseURL + v.ShortURL,
+				OriginalURL: v.OriginalURL,
+				DeletedAt:   v.DeletedAt,
+				PurgeAt:     purgeAt(v, retention),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(responce); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// NewRestoreURLsHandler эндпоинт восстановления удалённых ссылок пользователя.
+// Возвращает восстановленные ссылки.
+func NewRestoreURLsHandler(retention time.Duration, u handlers.UserURLRestorer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close() // Очищаем тело
+
+		if ok, err := handlers.CheckContentType("application/json", r); !ok {
+			logger.Warn(err.Error())
+			http.NotFound(w, r)
+			return
+		}
+
+		request := make([]string, 0)
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			logger.Warn("wrong body",
+				"error", err)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Получаем идентификатор пользователя из контекста
+		userID, err := middleware.GetUserID(r.Context())
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		restored, err := restore(r.Context(), u, userID, request, retention)
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(restored); err != nil {
+			logger.Error(fmt.Errorf("error encoding responce: %w", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// NewGRPCUserTrashHandler возвращает удалённые ссылки пользователя, которые ещё можно восстановить
+func NewGRPCUserTrashHandler(baseURL string, retention time.Duration, u handlers.UserURLGetter) handlers.GetUserTrashHandler {
+	return func(ctx context.Context, in *proto.UserURLsRequest) (*proto.UserTrashResponse, error) {
+		var response proto.UserTrashResponse
+
+		urls, err := userTrash(ctx, u, in.User, retention)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+
+		response.Response = make([]*proto.UserTrashResponse_TrashURL, len(urls))
+		for i, v := range urls {
+			item := &proto.UserTrashResponse_TrashURL{
+				ShortUrl:    baseURL + v.ShortURL,
+				OriginalUrl: v.OriginalURL,
+			}
+			if v.DeletedAt != nil {
+				item.DeletedAt = timestamppb.New(*v.DeletedAt)
+			}
+			if at := purgeAt(v, retention); at != nil {
+				item.PurgeAt = timestamppb.New(*at)
+			}
+			response.Response[i] = item
+		}
+
+		return &response, nil
+	}
+}
+
+// NewGRPCRestoreURLsHandler восстановление удалённых ссылок пользователя
+func NewGRPCRestoreURLsHandler(retention time.Duration, u handlers.UserURLRestorer) handlers.RestoreUserURLsHandler {
+	return func(ctx context.Context, in *proto.RestoreUserURLsRequest) (*proto.RestoreUserURLsResponse, error) {
+		restored, err := restore(ctx, u, in.User, in.ShortUrl, retention)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		return &proto.RestoreUserURLsResponse{ShortUrl: restored}, nil
+	}
+}
+
+// Удалённые неочищенные ссылки пользователя, срок хранения которых ещё не истёк.
+// Очистка идёт периодически, поэтому ссылки с истёкшим сроком могут ещё лежать в хранилище.
+func userTrash(ctx context.Context, u handlers.UserURLGetter, userID string, retention time.Duration) ([]model.StoreData, error) {
+	list, err := u.GetUserURLs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := make([]model.StoreData, 0)
+	for _, d := range list {
+		if !d.DeletedFlag || d.Purged() {
+			continue
+		}
+		if at := purgeAt(d, retention); at != nil && !now.Before(*at) {
+			continue
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// восстановление только тех ссылок, что есть в корзине пользователя
+func restore(ctx context.Context, u handlers.UserURLRestorer, userID string, shorts []string, retention time.Duration) ([]string, error) {
+	trash, err := userTrash(ctx, u, userID, retention)
+	if err != nil {
+		return nil, err
+	}
+
+	inTrash := make(map[string]bool, len(trash))
+	for _, d := range trash {
+		inTrash[d.ShortURL] = true
+	}
+
+	list := make([]string, 0, len(shorts))
+	for _, short := range shorts {
+		if inTrash[short] {
+			list = append(list, short)
+		}
+	}
+
+	restored := make([]string, 0, len(list))
+	if len(list) == 0 {
+		return restored, nil
+	}
+
+	res, err := u.RestoreShort(ctx, userID, list)
+	if err != nil {
+		return nil, err
+	}
+	return append(restored, res...), nil
+}
+
+// время окончательного удаления ссылки, nil - без срока хранения
+func purgeAt(data model.StoreData, retention time.Duration) *time.Time {
+	if retention <= 0 || data.DeletedAt == nil {
+		return nil
+	}
+	at := data.DeletedAt.Add(retention)
+	return &at
+}
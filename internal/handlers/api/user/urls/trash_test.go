@@ -0,0 +1,137 @@
+package urls
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/gen/go/proto/v1"
+	"github.com/eugene982/url-shortener/internal/middleware"
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage/memstore"
+)
+
+// хранилище с удалёнными ссылками s1 пользователя u1 и s3 пользователя u2
+func newTrashStore(t *testing.T) *memstore.MemStore {
+	store, err := memstore.New("")
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, store.Update(ctx, []model.StoreData{
+		{UserID: "u1", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "u1", ShortURL: "s2", OriginalURL: "go.dev"},
+		{UserID: "u2", ShortURL: "s3", OriginalURL: "google.com"},
+	}))
+	require.NoError(t, store.DeleteShort(ctx, []string{"s1", "s3"}))
+	return store
+}
+
+func TestUserTrashHandler(t *testing.T) {
+	store := newTrashStore(t)
+
+	tests := []struct {
+		name      string
+		user      string
+		retention time.Duration
+		code      int
+		want      []string
+	}{
+		{"trash", "u1", 0, http.StatusOK, []string{"/s1"}},
+		{"with retention", "u1", time.Hour, http.StatusOK, []string{"/s1"}},
+		{"retention expired", "u1", time.Nanosecond, http.StatusNoContent, nil},
+		{"empty", "u3", 0, http.StatusNoContent, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/urls/trash", nil)
+			w := httptest.NewRecorder()
+
+			NewUserTrashHandler("/", tt.retention, store).ServeHTTP(w, middleware.RequestWithUserID(r, tt.user))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var list []model.TrashURLResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+			require.Len(t, list, len(tt.want))
+			for i, item := range list {
+				assert.Equal(t, tt.want[i], item.ShortURL)
+				assert.NotNil(t, item.DeletedAt)
+				assert.Equal(t, tt.retention > 0, item.PurgeAt != nil)
+			}
+		})
+	}
+}
+
+func TestRestoreURLsHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		code        int
+		want        string
+	}{
+		{"not json", `["s1"]`, "text/plain", http.StatusNotFound, ""},
+		{"wrong body", `{"s1"}`, "application/json", http.StatusNotFound, ""},
+		{"restore", `["s1", "s2", "s3", "none"]`, "application/json", http.StatusOK, `["s1"]`},
+		{"nothing", `["s2"]`, "application/json", http.StatusOK, `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTrashStore(t)
+
+			r := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			NewRestoreURLsHandler(0, store).ServeHTTP(w, middleware.RequestWithUserID(r, "u1"))
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+			assert.JSONEq(t, tt.want, w.Body.String())
+
+			data, err := store.GetAddr(context.Background(), "s3")
+			require.NoError(t, err)
+			assert.True(t, data.DeletedFlag, "other user link")
+		})
+	}
+}
+
+func TestGRPCTrashAndRestore(t *testing.T) {
+	store := newTrashStore(t)
+	ctx := context.Background()
+
+	trash, err := NewGRPCUserTrashHandler("/", time.Hour, store)(ctx, &proto.UserURLsRequest{User: "u1"})
+	require.NoError(t, err)
+	require.Len(t, trash.Response, 1)
+	assert.Equal(t, "/s1", trash.Response[0].ShortUrl)
+	assert.Equal(t, "ya.ru", trash.Response[0].OriginalUrl)
+	require.NotNil(t, trash.Response[0].DeletedAt)
+	require.NotNil(t, trash.Response[0].PurgeAt)
+	assert.Equal(t, time.Hour, trash.Response[0].PurgeAt.AsTime().Sub(trash.Response[0].DeletedAt.AsTime()))
+
+	restored, err := NewGRPCRestoreURLsHandler(time.Hour, store)(ctx,
+		&proto.RestoreUserURLsRequest{User: "u1", ShortUrl: []string{"s1", "s3"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s1"}, restored.ShortUrl)
+
+	trash, err = NewGRPCUserTrashHandler("/", time.Hour, store)(ctx, &proto.UserURLsRequest{User: "u1"})
+	require.NoError(t, err)
+	assert.Empty(t, trash.Response)
+}
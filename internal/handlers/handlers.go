@@ -2,16 +2,21 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
 	"github.com/eugene982/url-shortener/internal/middleware"
 	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/eugene982/url-shortener/internal/shortener"
+	"github.com/eugene982/url-shortener/internal/storage"
 )
 
 // Pinger интерфейс проверки связи с сервисом.
@@ -29,14 +34,32 @@ type AddrGetter interface {
 	GetAddr(context.Context, string) (model.StoreData, error)
 }
 
+// BatchWriter интерфейс пакетной записи с проверкой занятых коротких ссылок.
+type BatchWriter interface {
+	Updater
+	AddrGetter
+}
+
 // UserURLGetter интерфейс получения сохраннённых ссылок пользователя.
 type UserURLGetter interface {
 	GetUserURLs(context.Context, string) ([]model.StoreData, error)
 }
 
 // UserShortAsyncDeleter интерфейс асинхронного удаления ссылок пользователя.
+// Возвращает идентификатор задачи удаления.
 type UserShortAsyncDeleter interface {
-	DeleteUserShortAsync(userID string, shorts []string)
+	DeleteUserShortAsync(userID string, shorts []string) (string, error)
+}
+
+// DeleteJobGetter интерфейс получения задачи удаления пользователя.
+type DeleteJobGetter interface {
+	DeleteJob(userID, jobID string) (model.DeleteJob, bool)
+}
+
+// UserURLRestorer интерфейс восстановления удалённых ссылок пользователя.
+type UserURLRestorer interface {
+	UserURLGetter
+	RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error)
 }
 
 // Updater интерфейс обновления данных в хранилище.
@@ -49,6 +72,21 @@ type StatsGetter interface {
 	Stats(ctx context.Context) (URLs int, users int, err error)
 }
 
+// PoolStatsGetter интерфейс хранилища с пулом соединений
+type PoolStatsGetter interface {
+	PoolStats() model.PoolStats
+}
+
+// CacheStatsGetter интерфейс хранилища с кешем
+type CacheStatsGetter interface {
+	CacheStats() model.CacheStats
+}
+
+// ShortenerStatsGetter интерфейс сокращателя со счётчиками
+type ShortenerStatsGetter interface {
+	ShortenerStats() model.ShortenerStats
+}
+
 // CheckContentType проверка заголовка запроса на формат.
 func CheckContentType(value string, r *http.Request) (bool, error) {
 	if strings.Contains(r.Header.Get("Content-Type"), value) {
@@ -58,43 +96,99 @@ func CheckContentType(value string, r *http.Request) (bool, error) {
 }
 
 // GetAndWriteShort ищем или пытаемся создать короткую ссылку.
-func GetAndWriteShort(sh shortener.Shortener, setter Setter, addr string, r *http.Request) (string, error) {
+// alias - желаемая короткая ссылка, пустая вычисляется по адресу.
+// expiresAt - срок действия ссылки, nil - бессрочная.
+func GetAndWriteShort(sh shortener.Shortener, setter Setter, addr, alias string, expiresAt *time.Time, r *http.Request) (string, error) {
 
 	userID, err := middleware.GetUserID(r.Context())
 	if err != nil {
 		return "", err
 	}
 
-	return GetAndWriteUserShort(r.Context(), sh, setter, userID, addr)
+	return GetAndWriteUserShort(r.Context(), sh, setter, userID, addr, alias, expiresAt)
 }
 
-// GetAndWriteUserShort - запись пользовательской ссылки
-func GetAndWriteUserShort(ctx context.Context, sh shortener.Shortener, setter Setter, userID, addr string) (string, error) {
+// ShortAttempts попыток вычислить свободную короткую ссылку.
+// Ссылка, занятая другим адресом, не перезаписывается:
+// вычисляется запасная, пока попытки не кончатся.
+const ShortAttempts = 5
 
-	short, err := sh.Short(addr)
-	if err != nil {
-		return "", err
-	}
+// GetAndWriteUserShort - запись пользовательской ссылки.
+// Если адрес уже сокращён, вместе с ErrAddressConflict возвращается
+// сохранённая ссылка: случайная или из счётчика с ней не совпадает.
+func GetAndWriteUserShort(ctx context.Context, sh shortener.Shortener, setter Setter, userID, addr, alias string, expiresAt *time.Time) (string, error) {
 
 	data := model.StoreData{
 		UserID:      userID,
-		ShortURL:    short,
 		OriginalURL: addr,
+		ExpiresAt:   expiresAt,
 	}
 
-	if ok, err := data.IsValid(); !ok {
-		return "", err
+	for attempt := 0; ; attempt++ {
+		short := alias
+		if short == "" {
+			var err error
+			if short, err = shortener.Retry(sh, addr, attempt); err != nil {
+				return "", err
+			}
+		}
+
+		data.ShortURL = short
+		if ok, err := data.IsValid(); !ok {
+			return "", err
+		}
+
+		// запись в файловое хранилище
+		err := setter.Set(ctx, data)
+		if alias != "" {
+			return short, err
+		}
+
+		// вычисленная ссылка занята другим адресом или владельцем
+		if errors.Is(err, storage.ErrShortConflict) && attempt+1 < ShortAttempts {
+			continue
+		}
+
+		if errors.Is(err, storage.ErrAddressConflict) && !errors.Is(err, storage.ErrShortConflict) {
+			if g, ok := storage.As[storage.OriginGetter](setter); ok {
+				if stored, gerr := g.GetByOrigin(ctx, userID, addr); gerr == nil {
+					short = stored.ShortURL
+				}
+			}
+		}
+		return short, err
 	}
-
-	// запись в файловое хранилище
-	return short, setter.Set(ctx, data)
 }
 
 // gRPC
 
+// ProtoExpiry срок действия ссылки из полей запроса gRPC
+func ProtoExpiry(now time.Time, expiresAt *timestamppb.Timestamp, ttl *durationpb.Duration) (*time.Time, error) {
+	var at *time.Time
+	if expiresAt != nil {
+		if err := expiresAt.CheckValid(); err != nil {
+			return nil, err
+		}
+		t := expiresAt.AsTime()
+		at = &t
+	}
+
+	var d time.Duration
+	if ttl != nil {
+		if err := ttl.CheckValid(); err != nil {
+			return nil, err
+		}
+		d = ttl.AsDuration()
+	}
+	return model.Expiry(now, at, d)
+}
+
 type PingHandler func(context.Context, *empty.Empty) (*proto.PingResponse, error)
 type FindAddrHandler func(context.Context, *proto.FindAddrRequest) (*proto.FindAddrResponse, error)
 type CreateShortHandler func(context.Context, *proto.CreateShortRequest) (*proto.CreateShortResponse, error)
 type BatchShortHandler func(context.Context, *proto.BatchRequest) (*proto.BatchResponse, error)
 type GetUserURLsHandler func(context.Context, *proto.UserURLsRequest) (*proto.UserURLsResponse, error)
-type DelUserURLsHandler func(context.Context, *proto.DelUserURLsRequest) (*empty.Empty, error)
+type DelUserURLsHandler func(context.Context, *proto.DelUserURLsRequest) (*proto.DelUserURLsResponse, error)
+type GetDeleteJobHandler func(context.Context, *proto.DeleteJobRequest) (*proto.DeleteJobResponse, error)
+type GetUserTrashHandler func(context.Context, *proto.UserURLsRequest) (*proto.UserTrashResponse, error)
+type RestoreUserURLsHandler func(context.Context, *proto.RestoreUserURLsRequest) (*proto.RestoreUserURLsResponse, error)
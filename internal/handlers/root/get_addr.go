@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"google.golang.org/grpc/codes"
@@ -32,7 +33,8 @@ func NewFindAddrHandler(g handlers.AddrGetter) http.HandlerFunc {
 			return
 		}
 
-		if data.DeletedFlag {
+		// удалённая или истёкшая ссылка
+		if data.DeletedFlag || data.Expired(time.Now()) {
 			http.Error(w, "410 Gone", http.StatusGone)
 			return
 		}
@@ -51,6 +53,9 @@ func NewGRPCFindAddrHandler(g handlers.AddrGetter) handlers.FindAddrHandler {
 		if err == nil {
 			if data.DeletedFlag {
 				return nil, status.Error(codes.NotFound, "Delete")
+			} else if data.Expired(time.Now()) {
+				// ссылка есть, но срок её действия вышел, как 410 в HTTP
+				return nil, status.Error(codes.FailedPrecondition, "Expired")
 			} else {
 				responce.OriginalUrl = data.OriginalURL
 			}
@@ -5,6 +5,10 @@ import (
 	"errors"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
 	"github.com/eugene982/url-shortener/internal/model"
@@ -129,3 +133,39 @@ func TestGRPCFindAddrHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestFindAddrHandlerExpired(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		code      int
+		grpcCode  codes.Code
+	}{
+		{"no expiry", nil, 307, codes.OK},
+		{"not expired", &future, 307, codes.OK},
+		{"expired", &past, 410, codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getter := addGetterFunc(func() (model.StoreData, error) {
+				return model.StoreData{
+					ShortURL:    "short",
+					OriginalURL: "ya.ru",
+					ExpiresAt:   tt.expiresAt}, nil
+			})
+
+			w := httptest.NewRecorder()
+			NewFindAddrHandler(getter).ServeHTTP(w, httptest.NewRequest("GET", "/short", nil))
+			resp := w.Result()
+			defer resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+
+			_, err := NewGRPCFindAddrHandler(getter)(context.Background(), &proto.FindAddrRequest{ShortUrl: "short"})
+			assert.Equal(t, tt.grpcCode, status.Code(err))
+		})
+	}
+}
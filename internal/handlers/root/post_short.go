@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
 	"github.com/eugene982/url-shortener/internal/handlers"
 	"github.com/eugene982/url-shortener/internal/logger"
+	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/eugene982/url-shortener/internal/shortener"
 	"github.com/eugene982/url-shortener/internal/storage"
 	"google.golang.org/grpc/codes"
@@ -32,10 +34,17 @@ func NewCreateShortHandler(baseURL string, setter handlers.Setter, sh shortener.
 		}
 
 		addr := string(body)
-		short, err := handlers.GetAndWriteShort(sh, setter, addr, r)
+		short, err := handlers.GetAndWriteShort(sh, setter, addr, "", nil, r)
 		if err == nil {
 			w.WriteHeader(http.StatusCreated)
 
+		} else if errors.Is(err, storage.ErrShortConflict) {
+			// короткая ссылка занята другим адресом, отдавать её нельзя
+			logger.Warn(err.Error(),
+				"url", addr)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+
 		} else if errors.Is(err, storage.ErrAddressConflict) {
 			logger.Warn(err.Error(),
 				"url", addr)
@@ -61,7 +70,21 @@ func NewGRPCCreateShortHandler(baseURL string, setter handlers.Setter, sh shorte
 	return func(ctx context.Context, in *proto.CreateShortRequest) (*proto.CreateShortResponse, error) {
 		var response proto.CreateShortResponse
 
-		short, err := handlers.GetAndWriteUserShort(ctx, sh, setter, in.User, in.OriginalUrl)
+		expiresAt, err := handlers.ProtoExpiry(time.Now(), in.ExpiresAt, in.Ttl)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		if in.Alias != "" {
+			if err = model.ValidateAlias(in.Alias); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			if err = shortener.CheckAlias(sh, in.Alias); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+
+		short, err := handlers.GetAndWriteUserShort(ctx, sh, setter, in.User, in.OriginalUrl, in.Alias, expiresAt)
 		if err == nil {
 			response.ShortUrl = baseURL + short
 			return &response, nil
@@ -11,6 +11,7 @@ import (
 	"github.com/eugene982/url-shortener/gen/go/proto/v1"
 	"github.com/eugene982/url-shortener/internal/middleware"
 	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/shortener"
 	"github.com/eugene982/url-shortener/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -115,10 +116,11 @@ func TestGRPCCreateShortHandler(t *testing.T) {
 	testErr := errors.New("some write error")
 
 	tests := []struct {
-		name string
-		url  string
-		err  error
-		want want
+		name  string
+		url   string
+		alias string
+		err   error
+		want  want
 	}{
 		{
 			name: "ok",
@@ -128,6 +130,43 @@ func TestGRPCCreateShortHandler(t *testing.T) {
 				short: "/YA.RU",
 			},
 		},
+		{
+			name:  "alias",
+			url:   "ya.ru",
+			alias: "spring-sale",
+			want: want{
+				err:   false,
+				short: "/spring-sale",
+			},
+		},
+		{
+			name:  "wrong alias",
+			url:   "ya.ru",
+			alias: "api",
+			want: want{
+				err:   true,
+				short: "",
+			},
+		},
+		{
+			name:  "blocked alias",
+			url:   "ya.ru",
+			alias: "spam-sale",
+			want: want{
+				err:   true,
+				short: "",
+			},
+		},
+		{
+			name:  "alias taken",
+			url:   "ya.ru",
+			alias: "spring-sale",
+			err:   storage.ErrShortConflict,
+			want: want{
+				err:   true,
+				short: "",
+			},
+		},
 		{
 			name: "conflict",
 			url:  "ya.ru",
@@ -157,13 +196,14 @@ func TestGRPCCreateShortHandler(t *testing.T) {
 				return tcase.err
 			})
 
-			shorten := shortenerFunc(func(s string) (string, error) {
+			shorten := shortener.NewFiltered(shortenerFunc(func(s string) (string, error) {
 				return strings.ToUpper(s), nil
-			})
+			}), shortener.NewFilter([]string{"spam"}))
 
 			in := proto.CreateShortRequest{
 				User:        "user",
 				OriginalUrl: tcase.url,
+				Alias:       tcase.alias,
 			}
 
 			resp, err := NewGRPCCreateShortHandler(base, setter, shorten)(context.Background(), &in)
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// Session прослойка открывает сессию хранилища на время запроса,
+// чтобы чтения после записи видели записанное.
+func Session(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(storage.WithSession(r.Context())))
+	}
+	return http.HandlerFunc(fn)
+}
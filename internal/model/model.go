@@ -3,11 +3,15 @@ package model
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Структура запроса /api/shorten
 type RequestShorten struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`      // желаемая короткая ссылка
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // срок действия ссылки
+	TTL       int64      `json:"ttl,omitempty"`        // или время жизни в секундах
 }
 
 // ResponseShorten Структура ответа /api/shorten
@@ -20,9 +24,68 @@ func (req RequestShorten) IsValid() (bool, error) {
 	if strings.TrimSpace(req.URL) == "" {
 		return false, fmt.Errorf("url is empty")
 	}
+	if req.Alias != "" {
+		if err := ValidateAlias(req.Alias); err != nil {
+			return false, err
+		}
+	}
 	return true, nil
 }
 
+// Допустимая длина желаемой короткой ссылки
+const (
+	AliasMinLen = 3
+	AliasMaxLen = 20 // по размеру колонки short_url
+)
+
+// слова, занятые путями сервиса
+var reservedAliases = map[string]bool{
+	"api":   true,
+	"ping":  true,
+	"debug": true,
+}
+
+// ValidateAlias проверка желаемой короткой ссылки:
+// латинские буквы, цифры, '-' и '_', длина от AliasMinLen до AliasMaxLen,
+// не совпадает с путями сервиса.
+func ValidateAlias(alias string) error {
+	if len(alias) < AliasMinLen || len(alias) > AliasMaxLen {
+		return fmt.Errorf("alias length must be from %d to %d", AliasMinLen, AliasMaxLen)
+	}
+	for _, c := range alias {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("alias contains invalid character %q", c)
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	return nil
+}
+
+// Expiry срок действия ссылки: явный или через время жизни от now.
+// Без обоих ссылка бессрочная и возвращается nil.
+func Expiry(now time.Time, expiresAt *time.Time, ttl time.Duration) (*time.Time, error) {
+	switch {
+	case expiresAt != nil && ttl != 0:
+		return nil, fmt.Errorf("both expires_at and ttl are set")
+	case ttl < 0:
+		return nil, fmt.Errorf("ttl is negative")
+	case ttl > 0:
+		t := now.Add(ttl).UTC()
+		return &t, nil
+	case expiresAt != nil:
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("expires_at is in the past")
+		}
+		t := expiresAt.UTC()
+		return &t, nil
+	}
+	return nil, nil
+}
+
 // StoreData данные для хранения в файловом хранилище
 type StoreData struct {
 	ID          string `json:"uuid"`
@@ -30,6 +93,20 @@ type StoreData struct {
 	ShortURL    string `json:"short_url" db:"short_url"`
 	OriginalURL string `json:"original_url" db:"origin_url"`
 	DeletedFlag bool   `json:"is_deleted" db:"is_deleted"`
+	// срок действия, nil - бессрочная
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	// время пометки на удаление
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// Expired истёк ли срок действия ссылки к моменту now
+func (st StoreData) Expired(now time.Time) bool {
+	return st.ExpiresAt != nil && !now.Before(*st.ExpiresAt)
+}
+
+// Purged очищенная удалённая ссылка: данные стёрты, короткая ссылка остаётся занятой
+func (st StoreData) Purged() bool {
+	return st.DeletedFlag && st.OriginalURL == ""
 }
 
 // IsValid валидация полей структуры StoreData
@@ -45,8 +122,11 @@ func (st StoreData) IsValid() (bool, error) {
 
 // BatchRequest запрос на добавление POST /api/shorten/batch
 type BatchRequest struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`      // желаемая короткая ссылка
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // срок действия ссылки
+	TTL           int64      `json:"ttl,omitempty"`        // или время жизни в секундах
 }
 
 // IsValid валидация полей входящей стуктуры BatchRequest
@@ -57,6 +137,11 @@ func (br BatchRequest) IsValid() (bool, error) {
 	if strings.TrimSpace(br.OriginalURL) == "" {
 		return false, fmt.Errorf("original URL is empty")
 	}
+	if br.Alias != "" {
+		if err := ValidateAlias(br.Alias); err != nil {
+			return false, err
+		}
+	}
 	return true, nil
 }
 
@@ -73,8 +158,89 @@ type UserURLResponse struct {
 	ShortURL    string `json:"short_url"`
 }
 
+// TrashURLResponse удалённая ссылка пользователя, доступная для восстановления.
+type TrashURLResponse struct {
+	OriginalURL string     `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt     *time.Time `json:"purge_at,omitempty"` // окончательное удаление, если задан срок хранения
+}
+
+// DeleteJobStatus состояние задачи асинхронного удаления
+type DeleteJobStatus string
+
+const (
+	DeleteJobPending DeleteJobStatus = "pending" // ожидает удаления
+	DeleteJobDone    DeleteJobStatus = "done"    // ссылки обработаны
+	DeleteJobFailed  DeleteJobStatus = "failed"  // хранилище не справилось за все попытки
+)
+
+// DeleteURLStatus итог удаления одной ссылки
+type DeleteURLStatus string
+
+const (
+	DeleteURLDeleted  DeleteURLStatus = "deleted"   // помечена на удаление
+	DeleteURLNotFound DeleteURLStatus = "not_found" // нет среди ссылок пользователя
+)
+
+// DeleteURLResult итог удаления ссылки в задаче
+type DeleteURLResult struct {
+	ShortURL string          `json:"short_url"`
+	Status   DeleteURLStatus `json:"status"`
+}
+
+// DeleteJob задача асинхронного удаления ссылок пользователя,
+// ответ GET /api/user/urls/delete/{job}
+type DeleteJob struct {
+	ID         string            `json:"job_id"`
+	UserID     string            `json:"-"`
+	ShortURLs  []string          `json:"-"`
+	Status     DeleteJobStatus   `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Results    []DeleteURLResult `json:"results,omitempty"` // для завершённой задачи
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// DeleteJobResponse ответ на удаление DELETE /api/user/urls
+type DeleteJobResponse struct {
+	JobID string `json:"job_id"`
+}
+
 // StatsResponse - ответ возвращает количество сокращений и пользователей
 type StatsResponse struct {
-	URLs  int `json:"urls"`
-	Users int `json:"users"`
+	URLs  int         `json:"urls"`
+	Users int         `json:"users"`
+	Pool  *PoolStats  `json:"pool,omitempty"`  // только для хранилищ с пулом соединений
+	Cache *CacheStats `json:"cache,omitempty"` // только при включённом кеше
+}
+
+// CacheStats счётчики кеша переходов по коротким ссылкам
+type CacheStats struct {
+	Size         int   `json:"size"`
+	Capacity     int   `json:"capacity"`
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negative_hits"` // из них об отсутствии ссылки
+	Misses       int64 `json:"misses"`
+	Evictions    int64 `json:"evictions"`
+}
+
+// ShortenerStats счётчики генерации коротких ссылок
+type ShortenerStats struct {
+	CollisionRetries int64 `json:"collision_retries"` // повторы из-за ссылки, занятой другим адресом
+}
+
+// PoolStats состояние пула соединений с базой
+type PoolStats struct {
+	MaxConns                int32         `json:"max_conns"`
+	TotalConns              int32         `json:"total_conns"`
+	AcquiredConns           int32         `json:"acquired_conns"`
+	IdleConns               int32         `json:"idle_conns"`
+	AcquireCount            int64         `json:"acquire_count"`
+	EmptyAcquireCount       int64         `json:"empty_acquire_count"` // ожидали свободного соединения
+	CanceledAcquireCount    int64         `json:"canceled_acquire_count"`
+	AcquireDuration         time.Duration `json:"acquire_duration"`
+	NewConnsCount           int64         `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64         `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64         `json:"max_idle_destroy_count"`
 }
@@ -2,6 +2,7 @@ package model
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +27,18 @@ func TestValidRequestShorten(t *testing.T) {
 			wantRes: true,
 			wantErr: false,
 		},
+		{
+			name:    "alias",
+			request: RequestShorten{URL: "ya.ru", Alias: "spring-sale"},
+			wantRes: true,
+			wantErr: false,
+		},
+		{
+			name:    "wrong alias",
+			request: RequestShorten{URL: "ya.ru", Alias: "api"},
+			wantRes: false,
+			wantErr: true,
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.name, func(t *testing.T) {
@@ -120,6 +133,12 @@ func TestValidBatchRequest(t *testing.T) {
 			wantRes: true,
 			wantErr: false,
 		},
+		{
+			name:    "wrong alias",
+			request: BatchRequest{CorrelationID: "short", OriginalURL: "ya.ry", Alias: "a b"},
+			wantRes: false,
+			wantErr: true,
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.name, func(t *testing.T) {
@@ -134,3 +153,80 @@ func TestValidBatchRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		alias   string
+		wantErr bool
+	}{
+		{"spring-sale", false},
+		{"Spring_2024", false},
+		{"abc", false},
+		{"ab", true},
+		{"abcdefghijklmnopqrstu", true},
+		{"spring sale", true},
+		{"весна", true},
+		{"a/b", true},
+		{"api", true},
+		{"PING", true},
+		{"debug", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			err := ValidateAlias(tt.alias)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	testCases := []struct {
+		name      string
+		expiresAt *time.Time
+		ttl       time.Duration
+		want      *time.Time
+		wantErr   bool
+	}{
+		{name: "none"},
+		{name: "ttl", ttl: time.Hour, want: &future},
+		{name: "expires_at", expiresAt: &future, want: &future},
+		{name: "both", expiresAt: &future, ttl: time.Hour, wantErr: true},
+		{name: "negative ttl", ttl: -time.Second, wantErr: true},
+		{name: "past", expiresAt: &past, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			got, err := Expiry(now, tC.expiresAt, tC.ttl)
+			if tC.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tC.want, got)
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	at := now.Add(time.Minute)
+
+	assert.False(t, StoreData{}.Expired(now))
+	assert.False(t, StoreData{ExpiresAt: &at}.Expired(now))
+	assert.True(t, StoreData{ExpiresAt: &at}.Expired(at))
+	assert.True(t, StoreData{ExpiresAt: &at}.Expired(at.Add(time.Second)))
+}
+
+func TestPurged(t *testing.T) {
+	assert.False(t, StoreData{ShortURL: "s", OriginalURL: "ya.ru"}.Purged())
+	assert.False(t, StoreData{ShortURL: "s", OriginalURL: "ya.ru", DeletedFlag: true}.Purged())
+	assert.True(t, StoreData{ShortURL: "s", DeletedFlag: true}.Purged())
+}
@@ -0,0 +1,58 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ожидание выдачи блока номеров
+const leaseTimeout = 5 * time.Second
+
+// Leaser источник непересекающихся блоков номеров, например хранилище
+type Leaser interface {
+	LeaseIDs(ctx context.Context, n uint64) (start uint64, err error)
+}
+
+// BlockSequence номера из блоков, арендуемых у общего источника.
+// Экземпляры сервиса с общим источником не выдают одинаковых номеров.
+type BlockSequence struct {
+	mx     sync.Mutex
+	leaser Leaser
+	size   uint64 // номеров в блоке
+	next   uint64 // очередной номер блока
+	end    uint64 // конец блока, не входит в него
+}
+
+// Утверждение типа, ошибка компиляции
+var _ Sequence = (*BlockSequence)(nil)
+
+// NewBlockSequence номера блоками по size у leaser
+func NewBlockSequence(leaser Leaser, size uint64) (*BlockSequence, error) {
+	if size == 0 {
+		return nil, errors.New("id block size must be positive")
+	}
+	return &BlockSequence{leaser: leaser, size: size}, nil
+}
+
+// Next очередной номер, при исчерпании блока арендуется следующий
+func (s *BlockSequence) Next() (uint64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.next == s.end {
+		ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+		defer cancel()
+
+		start, err := s.leaser.LeaseIDs(ctx, s.size)
+		if err != nil {
+			return 0, err
+		}
+		s.next, s.end = start, start+s.size
+	}
+
+	id := s.next
+	s.next++
+	return id, nil
+}
@@ -0,0 +1,93 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// источник блоков с учётом запросов
+type leaserFunc func(n uint64) (uint64, error)
+
+func (f leaserFunc) LeaseIDs(_ context.Context, n uint64) (uint64, error) {
+	return f(n)
+}
+
+func TestBlockSequence(t *testing.T) {
+	_, err := NewBlockSequence(nil, 0)
+	require.Error(t, err)
+
+	t.Run("blocks", func(t *testing.T) {
+		var next uint64 = 100
+		leases := 0
+		seq, err := NewBlockSequence(leaserFunc(func(n uint64) (uint64, error) {
+			leases++
+			start := next
+			next += n + 50 // между блоками других экземпляров
+			return start, nil
+		}), 3)
+		require.NoError(t, err)
+
+		var ids []uint64
+		for i := 0; i < 7; i++ {
+			id, err := seq.Next()
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		assert.Equal(t, []uint64{100, 101, 102, 153, 154, 155, 206}, ids)
+		assert.Equal(t, 3, leases)
+	})
+
+	t.Run("lease error", func(t *testing.T) {
+		errLease := errors.New("lease error")
+		fail := true
+		seq, err := NewBlockSequence(leaserFunc(func(n uint64) (uint64, error) {
+			if fail {
+				return 0, errLease
+			}
+			return 10, nil
+		}), 2)
+		require.NoError(t, err)
+
+		_, err = seq.Next()
+		require.ErrorIs(t, err, errLease)
+
+		// после ошибки блок запрашивается снова
+		fail = false
+		id, err := seq.Next()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(10), id)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var next uint64
+		seq, err := NewBlockSequence(leaserFunc(func(n uint64) (uint64, error) {
+			start := next
+			next += n
+			return start, nil
+		}), 10)
+		require.NoError(t, err)
+
+		sh, err := NewCounterShortener(WithSequence(seq))
+		require.NoError(t, err)
+
+		shorts := make([]string, 100)
+		var wg sync.WaitGroup
+		for i := range shorts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				short, err := sh.Short("")
+				assert.NoError(t, err)
+				shorts[i] = short
+			}(i)
+		}
+		wg.Wait()
+		assertUnique(t, shorts)
+		assert.Equal(t, uint64(100), next)
+	})
+}
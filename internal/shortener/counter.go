@@ -0,0 +1,165 @@
+package shortener
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/bits"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// ErrExhausted номера счётчика не помещаются в ссылку заданного размера
+var ErrExhausted = errors.New("short url counter exhausted")
+
+// Sequence источник уникальных номеров для счётчика
+type Sequence interface {
+	Next() (uint64, error)
+}
+
+// MemSequence счётчик в памяти экземпляра
+type MemSequence struct {
+	next atomic.Uint64
+}
+
+// Утверждение типа, ошибка компиляции
+var _ Sequence = (*MemSequence)(nil)
+
+// NewMemSequence счётчик, начинающийся с start
+func NewMemSequence(start uint64) *MemSequence {
+	s := new(MemSequence)
+	s.next.Store(start)
+	return s
+}
+
+// Next очередной номер
+func (s *MemSequence) Next() (uint64, error) {
+	return s.next.Add(1) - 1, nil
+}
+
+// CounterShortener сокращатель, кодирующий номер из счётчика.
+// Номер перемешивается взаимно однозначно в пределах ёмкости ссылки
+// и записывается алфавитом, перемешанным по соли, как в Hashids/Sqids.
+// Разные номера дают разные ссылки, соседние номера на вид не связаны.
+// Это сокрытие порядка, а не защита: зная соль, номер можно восстановить.
+type CounterShortener struct {
+	alphabet []byte
+	length   int
+	space    uint64 // ёмкость ссылки, 0 - все значения uint64
+	mult     uint64 // множитель, взаимно простой с ёмкостью
+	offset   uint64 // сдвиг, меньше ёмкости
+	seq      Sequence
+}
+
+// Утверждение типа, ошибка компиляции
+var _ Shortener = (*CounterShortener)(nil)
+
+// NewCounterShortener функция-конструктор сокращателя на счётчике.
+// Без WithSequence номера берутся из счётчика в памяти, начатого
+// с текущего времени в миллисекундах: после перезапуска номера
+// не повторяются, пока ссылок создаётся меньше тысячи в секунду.
+// Нескольким экземплярам нужен общий источник номеров.
+func NewCounterShortener(opts ...Option) (*CounterShortener, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(o.salt))
+	seed := h.Sum64()
+
+	alphabet := []byte(o.alphabet)
+	rnd := rand.New(rand.NewSource(int64(seed)))
+	rnd.Shuffle(len(alphabet), func(i, j int) {
+		alphabet[i], alphabet[j] = alphabet[j], alphabet[i]
+	})
+
+	s := &CounterShortener{
+		alphabet: alphabet,
+		length:   o.length,
+		space:    capacity(uint64(len(alphabet)), o.length),
+		seq:      o.seq,
+	}
+
+	// множитель и сдвиг тоже зависят от соли
+	s.mult = rnd.Uint64() | 1
+	s.offset = rnd.Uint64()
+	if s.space != 0 {
+		s.offset %= s.space
+		s.mult %= s.space
+		for gcd(s.mult, s.space) != 1 {
+			s.mult++
+		}
+	}
+
+	if s.seq == nil {
+		start := uint64(time.Now().UnixMilli())
+		if s.space != 0 {
+			start %= s.space
+		}
+		s.seq = NewMemSequence(start)
+	}
+	return s, nil
+}
+
+// Short возвращает ссылку для очередного номера счётчика, адрес не используется.
+func (s *CounterShortener) Short(string) (string, error) {
+	id, err := s.seq.Next()
+	if err != nil {
+		return "", err
+	}
+	return s.encode(id)
+}
+
+// запись номера id перемешанным алфавитом
+func (s *CounterShortener) encode(id uint64) (string, error) {
+	if s.space != 0 && id >= s.space {
+		return "", ErrExhausted
+	}
+
+	val := s.permute(id)
+	size := uint64(len(s.alphabet))
+
+	buff := make([]byte, s.length)
+	for i := range buff {
+		buff[i] = s.alphabet[val%size]
+		val /= size
+	}
+	return string(buff), nil
+}
+
+// Взаимно однозначное отображение [0, space) на себя:
+// умножение на взаимно простое с ёмкостью число и сдвиг.
+func (s *CounterShortener) permute(id uint64) uint64 {
+	if s.space == 0 {
+		return id*s.mult + s.offset
+	}
+
+	hi, lo := bits.Mul64(id, s.mult)
+	_, val := bits.Div64(hi, lo, s.space) // hi < space, так как id и mult меньше space
+	if val >= s.space-s.offset {
+		return val - (s.space - s.offset)
+	}
+	return val + s.offset
+}
+
+// Ёмкость ссылки size^length, 0 - если превышает uint64
+func capacity(size uint64, length int) uint64 {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(space, size)
+		if hi != 0 {
+			return 0
+		}
+		space = lo
+	}
+	return space
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,105 @@
+package shortener
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterShort(t *testing.T) {
+	t.Run("whole space", func(t *testing.T) {
+		// ёмкость 4^3 = 64 ссылки, все различны
+		sh, err := NewCounterShortener(WithLength(3), WithAlphabet("abcd"), WithSequence(NewMemSequence(0)))
+		require.NoError(t, err)
+
+		shorts := make([]string, 64)
+		for i := range shorts {
+			shorts[i], err = sh.Short("http://ya.ru")
+			require.NoError(t, err)
+			assert.Len(t, shorts[i], 3)
+		}
+		assertUnique(t, shorts)
+
+		_, err = sh.Short("http://ya.ru")
+		assert.ErrorIs(t, err, ErrExhausted)
+	})
+
+	t.Run("salt", func(t *testing.T) {
+		one, err := NewCounterShortener(WithSalt("one"), WithSequence(NewMemSequence(42)))
+		require.NoError(t, err)
+		same, err := NewCounterShortener(WithSalt("one"), WithSequence(NewMemSequence(42)))
+		require.NoError(t, err)
+		two, err := NewCounterShortener(WithSalt("two"), WithSequence(NewMemSequence(42)))
+		require.NoError(t, err)
+
+		s1, err := one.Short("")
+		require.NoError(t, err)
+		s2, err := same.Short("")
+		require.NoError(t, err)
+		s3, err := two.Short("")
+		require.NoError(t, err)
+
+		assert.Equal(t, s1, s2)
+		assert.NotEqual(t, s1, s3)
+	})
+
+	t.Run("long", func(t *testing.T) {
+		// ёмкость больше uint64
+		sh, err := NewCounterShortener(WithLength(MaxLength), WithSequence(NewMemSequence(0)))
+		require.NoError(t, err)
+		assert.Zero(t, sh.space)
+
+		shorts := make([]string, 1000)
+		for i := range shorts {
+			shorts[i], err = sh.Short("")
+			require.NoError(t, err)
+			assert.Len(t, shorts[i], MaxLength)
+		}
+		assertUnique(t, shorts)
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		// соседние номера не дают похожих ссылок
+		sh, err := NewCounterShortener(WithSequence(NewMemSequence(0)))
+		require.NoError(t, err)
+
+		shorts := make([]string, 20000)
+		for i := range shorts {
+			shorts[i], err = sh.Short("")
+			require.NoError(t, err)
+		}
+		assertUnique(t, shorts)
+		assertUniform(t, shorts, string(sh.alphabet), hashLen)
+	})
+
+	t.Run("sequence error", func(t *testing.T) {
+		sh, err := NewCounterShortener(WithSequence(seqFunc(func() (uint64, error) {
+			return 0, errors.New("no ids")
+		})))
+		require.NoError(t, err)
+
+		_, err = sh.Short("")
+		assert.Error(t, err)
+	})
+}
+
+func TestCounterPermute(t *testing.T) {
+	sh, err := NewCounterShortener(WithLength(2), WithAlphabet("0123456789"), WithSalt("salt"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), sh.space)
+
+	// взаимно однозначно на всей ёмкости
+	seen := make(map[uint64]bool, sh.space)
+	for id := uint64(0); id < sh.space; id++ {
+		val := sh.permute(id)
+		require.Less(t, val, sh.space)
+		require.False(t, seen[val])
+		seen[val] = true
+	}
+}
+
+type seqFunc func() (uint64, error)
+
+func (f seqFunc) Next() (uint64, error) { return f() }
@@ -0,0 +1,157 @@
+package shortener
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// filterAttempts попыток получить ссылку, прошедшую фильтр
+const filterAttempts = 10
+
+// ErrRejected ссылка отклонена фильтром
+var ErrRejected = errors.New("short url rejected by filter")
+
+// Filter фильтр коротких ссылок: запрещённые слова внутри ссылки
+// и зарезервированные слова, с которыми ссылка не должна совпадать,
+// например пути сервиса. Регистр не учитывается.
+type Filter struct {
+	mx       sync.RWMutex
+	words    []string
+	reserved map[string]bool
+}
+
+// NewFilter фильтр по запрещённым словам words
+func NewFilter(words []string) *Filter {
+	f := &Filter{reserved: make(map[string]bool)}
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			f.words = append(f.words, w)
+		}
+	}
+	return f
+}
+
+// LoadWords запрещённые слова из файла, по слову в строке.
+// Пустые строки и строки с '#' в начале пропускаются.
+func LoadWords(fname string) ([]string, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error read blocklist: %w", err)
+	}
+	return words, nil
+}
+
+// Reserve добавление зарезервированных слов
+func (f *Filter) Reserve(words ...string) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	for _, w := range words {
+		if w != "" {
+			f.reserved[strings.ToLower(w)] = true
+		}
+	}
+}
+
+// Check проверка ссылки, отклонённая возвращает ErrRejected
+func (f *Filter) Check(short string) error {
+	lower := strings.ToLower(short)
+
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	if f.reserved[lower] {
+		return fmt.Errorf("%w: %q is reserved", ErrRejected, short)
+	}
+	for _, w := range f.words {
+		if strings.Contains(lower, w) {
+			return fmt.Errorf("%w: %q contains blocked word", ErrRejected, short)
+		}
+	}
+	return nil
+}
+
+// Filtered сокращатель, заменяющий отклонённые фильтром ссылки новыми
+type Filtered struct {
+	Shortener
+	filter *Filter
+}
+
+// Утверждение типа, ошибка компиляции
+var _ Retrier = (*Filtered)(nil)
+
+// NewFiltered проверка ссылок сокращателя s фильтром f
+func NewFiltered(s Shortener, f *Filter) *Filtered {
+	return &Filtered{Shortener: s, filter: f}
+}
+
+// Short ссылка, прошедшая фильтр
+func (f *Filtered) Short(addr string) (string, error) {
+	return f.Retry(addr, 0)
+}
+
+// Retry ссылка для попытки attempt, прошедшая фильтр.
+// Отклонённая ссылка вычисляется заново по адресу с другой солью,
+// поэтому хеш остаётся детерминированным и не совпадает
+// с запасными ссылками после коллизий.
+func (f *Filtered) Retry(addr string, attempt int) (string, error) {
+	for i := 0; i < filterAttempts; i++ {
+		src := addr
+		if i > 0 {
+			src = addr + "\x01" + strconv.Itoa(i)
+		}
+		short, err := Retry(f.Shortener, src, attempt)
+		if err != nil {
+			return "", err
+		}
+		if f.filter.Check(short) == nil {
+			return short, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no acceptable short url in %d attempts", ErrRejected, filterAttempts)
+}
+
+// Unwrap проверяемый сокращатель
+func (f *Filtered) Unwrap() Shortener {
+	return f.Shortener
+}
+
+// Unwrapper обёртка над другим сокращателем
+type Unwrapper interface {
+	Unwrap() Shortener
+}
+
+// CheckAlias проверка желаемой ссылки фильтром сокращателя s.
+// Без фильтра в цепочке обёрток и без желаемой ссылки проверять нечего.
+func CheckAlias(s Shortener, alias string) error {
+	for alias != "" && s != nil {
+		if f, ok := s.(*Filtered); ok {
+			return f.filter.Check(alias)
+		}
+		u, ok := s.(Unwrapper)
+		if !ok {
+			return nil
+		}
+		s = u.Unwrap()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package shortener
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterCheck(t *testing.T) {
+	f := NewFilter([]string{"Bad", " ", "evil "})
+	f.Reserve("ping", "api", "")
+
+	tests := []struct {
+		short    string
+		rejected bool
+	}{
+		{"good", false},
+		{"xxBADxx", true},
+		{"evil", true},
+		{"ping", true},
+		{"PING", true},
+		{"pings", false},
+		{"Api", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.short, func(t *testing.T) {
+			err := f.Check(tt.short)
+			if tt.rejected {
+				assert.ErrorIs(t, err, ErrRejected)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLoadWords(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(fname, []byte("# comment\nbad\n\n  evil  \n"), 0600))
+
+	words, err := LoadWords(fname)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bad", "evil"}, words)
+
+	_, err = LoadWords(filepath.Join(t.TempDir(), "none.txt"))
+	assert.Error(t, err)
+}
+
+// сокращатель, выдающий ссылки по очереди
+type listShortener []string
+
+func (l *listShortener) Short(string) (string, error) {
+	short := (*l)[0]
+	*l = (*l)[1:]
+	return short, nil
+}
+
+func TestFiltered(t *testing.T) {
+	t.Run("regenerate", func(t *testing.T) {
+		f := NewFilter([]string{"bad"})
+		f.Reserve("ping")
+		sh := NewFiltered(&listShortener{"abadc", "ping", "good"}, f)
+
+		short, err := sh.Short("http://ya.ru")
+		require.NoError(t, err)
+		assert.Equal(t, "good", short)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		list := listShortener(strings.Split(strings.Repeat("bad,", filterAttempts), ","))
+		sh := NewFiltered(&list, NewFilter([]string{"bad"}))
+
+		_, err := sh.Short("http://ya.ru")
+		assert.ErrorIs(t, err, ErrRejected)
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		plain := NewSimpleShortener()
+		first, err := plain.Short("http://ya.ru")
+		require.NoError(t, err)
+
+		// ссылка по адресу запрещена, замена детерминирована
+		sh := NewFiltered(plain, NewFilter([]string{first}))
+		short, err := sh.Short("http://ya.ru")
+		require.NoError(t, err)
+		assert.NotEqual(t, first, short)
+
+		again, err := sh.Short("http://ya.ru")
+		require.NoError(t, err)
+		assert.Equal(t, short, again)
+
+		// запасные ссылки после коллизий тоже проходят фильтр и отличаются
+		retry, err := Retry(NewMetered(sh), "http://ya.ru", 1)
+		require.NoError(t, err)
+		assert.NotEqual(t, first, retry)
+		assert.NotEqual(t, short, retry)
+	})
+}
+
+func TestCheckAlias(t *testing.T) {
+	f := NewFilter([]string{"bad"})
+	sh := NewMetered(NewFiltered(NewSimpleShortener(), f))
+
+	assert.ErrorIs(t, CheckAlias(sh, "notbad"), ErrRejected)
+	assert.NoError(t, CheckAlias(sh, "good"))
+
+	// без фильтра допустима любая
+	assert.NoError(t, CheckAlias(NewMetered(NewSimpleShortener()), "notbad"))
+}
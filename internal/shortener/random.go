@@ -0,0 +1,57 @@
+package shortener
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// RandomShortener сокращатель, выдающий криптографически случайные ссылки.
+// Ссылка не зависит от адреса и не предсказуема.
+type RandomShortener struct {
+	alphabet []byte
+	length   int
+	limit    int       // байты не меньше limit отбрасываются, чтобы символы были равновероятны
+	rand     io.Reader // источник случайных байт
+}
+
+// Утверждение типа, ошибка компиляции
+var _ Shortener = (*RandomShortener)(nil)
+
+// NewRandomShortener функция-конструктор случайного сокращателя
+func NewRandomShortener(opts ...Option) (*RandomShortener, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(o.alphabet)
+	return &RandomShortener{
+		alphabet: []byte(o.alphabet),
+		length:   o.length,
+		limit:    256 - 256%size,
+		rand:     rand.Reader,
+	}, nil
+}
+
+// Short возвращает случайную короткую ссылку, адрес не используется.
+func (s *RandomShortener) Short(string) (string, error) {
+	short := make([]byte, 0, s.length)
+	buff := make([]byte, s.length*2)
+
+	for len(short) < s.length {
+		if _, err := io.ReadFull(s.rand, buff); err != nil {
+			return "", fmt.Errorf("cannot generate short url: %w", err)
+		}
+		for _, b := range buff {
+			if int(b) >= s.limit {
+				continue
+			}
+			short = append(short, s.alphabet[int(b)%len(s.alphabet)])
+			if len(short) == s.length {
+				break
+			}
+		}
+	}
+	return string(short), nil
+}
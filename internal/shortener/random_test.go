@@ -0,0 +1,43 @@
+package shortener
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandomShort(t *testing.T) {
+	sh, err := NewRandomShortener(WithLength(12), WithAlphabet("0123456789"))
+	require.NoError(t, err)
+
+	shorts := make([]string, 10000)
+	for i := range shorts {
+		// адрес на ссылку не влияет
+		shorts[i], err = sh.Short("http://ya.ru")
+		require.NoError(t, err)
+		assert.Len(t, shorts[i], 12)
+		assert.Empty(t, strings.Trim(shorts[i], "0123456789"))
+	}
+	assertUnique(t, shorts)
+	assertUniform(t, shorts, "0123456789", 12)
+}
+
+func TestRandomShortBytes(t *testing.T) {
+	sh, err := NewRandomShortener(WithLength(3), WithAlphabet("abc"))
+	require.NoError(t, err)
+
+	// 255 не меньше порога 255 и отбрасывается, иначе 'a' выпадала бы чаще
+	sh.rand = bytes.NewReader([]byte{255, 0, 4, 254, 9, 9})
+	short, err := sh.Short("")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", short)
+
+	sh.rand = iotest.ErrReader(errors.New("no entropy"))
+	_, err = sh.Short("")
+	assert.Error(t, err)
+}
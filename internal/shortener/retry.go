@@ -0,0 +1,65 @@
+package shortener
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// Retrier сокращатель с запасными ссылками на случай коллизии
+type Retrier interface {
+	Shortener
+	Retry(addr string, attempt int) (string, error)
+}
+
+// Retry ссылка для попытки attempt: нулевая - обычная, следующие
+// после коллизии вычисляются по адресу с солью из номера попытки,
+// поэтому хеш даёт другую ссылку. Случайная стратегия и счётчик
+// адрес не используют и просто выдают новую.
+func Retry(s Shortener, addr string, attempt int) (string, error) {
+	if attempt == 0 {
+		return s.Short(addr)
+	}
+	if r, ok := s.(Retrier); ok {
+		return r.Retry(addr, attempt)
+	}
+	return s.Short(salted(addr, attempt))
+}
+
+// адрес с солью, нулевой байт в адресе ссылки не встречается
+func salted(addr string, attempt int) string {
+	return addr + "\x00" + strconv.Itoa(attempt)
+}
+
+// Metered сокращатель со счётчиком повторных попыток после коллизий
+type Metered struct {
+	Shortener
+	retries atomic.Int64
+}
+
+// Утверждение типа, ошибка компиляции
+var _ Retrier = (*Metered)(nil)
+
+// NewMetered учёт повторных попыток сокращателя s
+func NewMetered(s Shortener) *Metered {
+	return &Metered{Shortener: s}
+}
+
+// Retry ссылка для повторной попытки, учитывается в счётчике
+func (m *Metered) Retry(addr string, attempt int) (string, error) {
+	m.retries.Add(1)
+	return Retry(m.Shortener, addr, attempt)
+}
+
+// Unwrap учитываемый сокращатель
+func (m *Metered) Unwrap() Shortener {
+	return m.Shortener
+}
+
+// ShortenerStats счётчики сокращателя для метрик
+func (m *Metered) ShortenerStats() model.ShortenerStats {
+	return model.ShortenerStats{
+		CollisionRetries: m.retries.Load(),
+	}
+}
@@ -0,0 +1,51 @@
+package shortener
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	sh := NewSimpleShortener()
+
+	first, err := Retry(sh, "http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "SbXCfyuJdo", first)
+
+	// попытки с солью дают разные ссылки, повтор попытки - ту же
+	seen := map[string]bool{first: true}
+	for attempt := 1; attempt < 5; attempt++ {
+		short, err := Retry(sh, "http://ya.ru", attempt)
+		require.NoError(t, err)
+		assert.False(t, seen[short], attempt)
+		seen[short] = true
+
+		again, err := Retry(sh, "http://ya.ru", attempt)
+		require.NoError(t, err)
+		assert.Equal(t, short, again)
+	}
+}
+
+func TestMetered(t *testing.T) {
+	m := NewMetered(NewSimpleShortener())
+
+	short, err := Retry(m, "http://ya.ru", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "SbXCfyuJdo", short)
+	assert.Zero(t, m.ShortenerStats().CollisionRetries)
+
+	retry, err := Retry(m, "http://ya.ru", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, short, retry)
+
+	// та же соль, что и без учёта
+	plain, err := Retry(NewSimpleShortener(), "http://ya.ru", 1)
+	require.NoError(t, err)
+	assert.Equal(t, plain, retry)
+
+	_, err = Retry(m, "http://ya.ru", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), m.ShortenerStats().CollisionRetries)
+}
@@ -1,6 +1,7 @@
-// "Сокращатель" ссылок, построен на снове алгоритма crc64,
-// доступного в стандартной библиотеке.
-// Удовлетворяет интерфейсу "Shortener"
+// "Сокращатель" ссылок. Стратегии получения короткой ссылки:
+// контрольная сумма crc64 адреса, криптографически случайная строка
+// и номер из счётчика, записанный перемешанным алфавитом.
+// Удовлетворяют интерфейсу "Shortener"
 package shortener
 
 import (
@@ -10,6 +11,12 @@ import (
 
 const (
 	hashLen = 10 // размер сокращения
+
+	// MaxLength наибольший размер сокращения, столько вмещает поле короткой ссылки в хранилищах
+	MaxLength = 20
+
+	// DefaultAlphabet символы сокращения по умолчанию
+	DefaultAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 )
 
 // Shortener интерфейс сокращателя ссылок
@@ -17,11 +24,123 @@ type Shortener interface {
 	Short(string) (string, error)
 }
 
+// Strategy способ получения короткой ссылки
+type Strategy string
+
+const (
+	StrategyHash    Strategy = "hash"    // контрольная сумма адреса, один адрес - одна ссылка
+	StrategyRandom  Strategy = "random"  // криптографически случайная строка
+	StrategyCounter Strategy = "counter" // номер из счётчика в перемешанном алфавите
+)
+
+// ParseStrategy стратегия по названию
+func ParseStrategy(s string) (Strategy, error) {
+	switch strategy := Strategy(s); strategy {
+	case StrategyHash, StrategyRandom, StrategyCounter:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown shortener strategy %q", s)
+}
+
+// настройки сокращателя
+type options struct {
+	length   int
+	alphabet string
+	salt     string
+	seq      Sequence
+}
+
+// Option настройка сокращателя
+type Option func(*options)
+
+// WithLength размер сокращения
+func WithLength(n int) Option {
+	return func(o *options) {
+		o.length = n
+	}
+}
+
+// WithAlphabet символы сокращения.
+// Допустимы латинские буквы, цифры, '-' и '_' без повторов.
+func WithAlphabet(alphabet string) Option {
+	return func(o *options) {
+		o.alphabet = alphabet
+	}
+}
+
+// WithSalt соль перемешивания алфавита счётчика.
+// Экземпляры с разной солью выдают разные ссылки для одного номера.
+func WithSalt(salt string) Option {
+	return func(o *options) {
+		o.salt = salt
+	}
+}
+
+// WithSequence источник номеров счётчика
+func WithSequence(seq Sequence) Option {
+	return func(o *options) {
+		o.seq = seq
+	}
+}
+
+// применение и проверка настроек
+func newOptions(opts []Option) (options, error) {
+	o := options{
+		length:   hashLen,
+		alphabet: DefaultAlphabet,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.length < 1 || o.length > MaxLength {
+		return o, fmt.Errorf("short length %d out of range 1..%d", o.length, MaxLength)
+	}
+	if len(o.alphabet) < 2 {
+		return o, fmt.Errorf("short alphabet %q is too small", o.alphabet)
+	}
+	var seen [256]bool
+	for i := 0; i < len(o.alphabet); i++ {
+		c := o.alphabet[i]
+		if !isAlphabetChar(c) {
+			return o, fmt.Errorf("short alphabet %q: invalid char %q", o.alphabet, c)
+		}
+		if seen[c] {
+			return o, fmt.Errorf("short alphabet %q: duplicate char %q", o.alphabet, c)
+		}
+		seen[c] = true
+	}
+	return o, nil
+}
+
+// символ, допустимый в пути ссылки без экранирования
+func isAlphabetChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_'
+}
+
+// New сокращатель выбранной стратегии
+func New(strategy Strategy, opts ...Option) (Shortener, error) {
+	switch strategy {
+	case StrategyHash:
+		o, err := newOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		return newSimpleShortener(o), nil
+	case StrategyRandom:
+		return NewRandomShortener(opts...)
+	case StrategyCounter:
+		return NewCounterShortener(opts...)
+	}
+	return nil, fmt.Errorf("unknown shortener strategy %q", strategy)
+}
+
 // SimpleShortener реализация простого сокращателя.
+// Ссылка зависит только от адреса, поэтому предсказуема.
 type SimpleShortener struct {
 	symTab []byte       // символы для хеша
 	crcTab *crc64.Table // для контрольной суммы
-
+	length int          // размер сокращения
 }
 
 // Утверждение типа, ошибка компиляции
@@ -29,30 +148,21 @@ var _ Shortener = (*SimpleShortener)(nil)
 
 // NewSimpleShortener функция-конструктор сокращателя
 func NewSimpleShortener() *SimpleShortener {
-	// создаём таблицу символов которые будем использовать в хеше
-	symTab := make([]byte, 0, 64)
-
-	// заполняем символами которые учавствуют в хеше
-	var c byte
-	for c = '0'; c <= '9'; c++ {
-		symTab = append(symTab, c)
-	}
-	for c = 'a'; c <= 'z'; c++ {
-		symTab = append(symTab, c)
-	}
-	for c = 'A'; c <= 'Z'; c++ {
-		symTab = append(symTab, c)
-	}
+	o, _ := newOptions(nil)
+	return newSimpleShortener(o)
+}
 
+func newSimpleShortener(o options) *SimpleShortener {
 	return &SimpleShortener{
-		symTab,
-		crc64.MakeTable(crc64.ISO),
+		symTab: []byte(o.alphabet),
+		crcTab: crc64.MakeTable(crc64.ISO),
+		length: o.length,
 	}
 }
 
 // Short возвращает короткую ссылку.
 // Реализация интерфецса.
-// Будем сохкращать строку до 10 символов
+// Будем сохкращать строку до 10 символов, если размер не задан
 func (s *SimpleShortener) Short(addr string) (short string, err error) {
 	sum := crc64.Checksum([]byte(addr), s.crcTab)
 	short = s.toString(sum)
@@ -65,14 +175,14 @@ func (s *SimpleShortener) Short(addr string) (short string, err error) {
 // Функция преобразует хэш в строку нужной длинны
 // Пробовал на основе base64 но случаются коллизии т.к. начало строк часто совпадают.
 func (s *SimpleShortener) toString(val uint64) string {
-	var buff [hashLen]byte
+	var buff [MaxLength]byte
 
 	reminder := val
 	size := len(s.symTab)
 
-	for i := 0; i < hashLen; i++ {
+	for i := 0; i < s.length; i++ {
 		buff[i] = s.symTab[(reminder % uint64(size))]
 		reminder /= uint64(size)
 	}
-	return string(buff[:])
+	return string(buff[:s.length])
 }
@@ -1,6 +1,9 @@
 package shortener
 
 import (
+	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -43,6 +46,123 @@ func TestShort(t *testing.T) {
 	}
 }
 
+func TestShortOptions(t *testing.T) {
+	t.Run("length and alphabet", func(t *testing.T) {
+		sh, err := New(StrategyHash, WithLength(16), WithAlphabet("abcdef"))
+		require.NoError(t, err)
+
+		short, err := sh.Short("http://ya.ru")
+		require.NoError(t, err)
+		assert.Len(t, short, 16)
+		assert.Empty(t, strings.Trim(short, "abcdef"))
+	})
+
+	t.Run("default", func(t *testing.T) {
+		sh, err := New(StrategyHash)
+		require.NoError(t, err)
+
+		short, err := sh.Short("http://ya.ru")
+		require.NoError(t, err)
+		assert.Equal(t, "SbXCfyuJdo", short)
+	})
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"zero length", []Option{WithLength(0)}},
+		{"too long", []Option{WithLength(MaxLength + 1)}},
+		{"small alphabet", []Option{WithAlphabet("a")}},
+		{"duplicate", []Option{WithAlphabet("abca")}},
+		{"invalid char", []Option{WithAlphabet("ab/c")}},
+	}
+	for _, tcase := range tests {
+		for _, strategy := range []Strategy{StrategyHash, StrategyRandom, StrategyCounter} {
+			t.Run(fmt.Sprintf("%s %s", strategy, tcase.name), func(t *testing.T) {
+				_, err := New(strategy, tcase.opts...)
+				assert.Error(t, err)
+			})
+		}
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for _, name := range []string{"hash", "random", "counter"} {
+		strategy, err := ParseStrategy(name)
+		require.NoError(t, err)
+		assert.Equal(t, Strategy(name), strategy)
+	}
+
+	_, err := ParseStrategy("crc")
+	assert.Error(t, err)
+}
+
+func TestStrategiesDistribution(t *testing.T) {
+	const count = 20000
+
+	// crc64 линейна, у похожих адресов старшие символы ссылки связаны,
+	// поэтому для хеша проверяются только младшие позиции
+	tests := []struct {
+		strategy  Strategy
+		positions int
+	}{
+		{StrategyHash, 6},
+		{StrategyRandom, hashLen},
+		{StrategyCounter, hashLen},
+	}
+
+	for _, tcase := range tests {
+		t.Run(string(tcase.strategy), func(t *testing.T) {
+			sh, err := New(tcase.strategy)
+			require.NoError(t, err)
+
+			shorts := make([]string, count)
+			for i := range shorts {
+				shorts[i], err = sh.Short(fmt.Sprintf("http://example.com/%d", i))
+				require.NoError(t, err)
+			}
+			assertUnique(t, shorts)
+			assertUniform(t, shorts, DefaultAlphabet, tcase.positions)
+		})
+	}
+}
+
+// все ссылки различны
+func assertUnique(t *testing.T, shorts []string) {
+	t.Helper()
+	seen := make(map[string]struct{}, len(shorts))
+	for _, short := range shorts {
+		_, dup := seen[short]
+		require.False(t, dup, "duplicate short %q", short)
+		seen[short] = struct{}{}
+	}
+}
+
+// Символы в каждой позиции ссылок равновероятны: критерий хи-квадрат
+// с порогом в пять стандартных отклонений от числа степеней свободы.
+// Проверяются первые positions позиций.
+func assertUniform(t *testing.T, shorts []string, alphabet string, positions int) {
+	t.Helper()
+	size := len(alphabet)
+	expected := float64(len(shorts)) / float64(size)
+	df := float64(size - 1)
+	limit := df + 5*math.Sqrt(2*df)
+
+	for pos := 0; pos < positions; pos++ {
+		counts := make(map[byte]int, size)
+		for _, short := range shorts {
+			counts[short[pos]]++
+		}
+
+		var chi2 float64
+		for i := 0; i < size; i++ {
+			d := float64(counts[alphabet[i]]) - expected
+			chi2 += d * d / expected
+		}
+		assert.Less(t, chi2, limit, "position %d is not uniform", pos)
+	}
+}
+
 func BenchmarkShort(b *testing.B) {
 	shortener := NewSimpleShortener()
 	b.ResetTimer()
@@ -0,0 +1,771 @@
+// Хранение ссылок во встроенной базе ключ-значение bbolt.
+// Для развёртывания на одном узле с большим количеством ссылок.
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// Scheme префикс строки подключения: bolt://path/to/file.db
+const Scheme = "bolt://"
+
+var (
+	bucketURLs    = []byte("urls")    // короткая ссылка -> данные
+	bucketOrigins = []byte("origins") // ключ уникальности адреса -> короткая ссылка
+	bucketUsers   = []byte("users")   // пользователь и короткая ссылка -> пусто
+	bucketLive    = []byte("live")    // пользователь -> количество неудалённых ссылок
+	bucketMeta    = []byte("meta")    // счётчики статистики
+	bucketExpires = []byte("expires") // срок действия и короткая ссылка -> пусто, только неудалённые
+	bucketDeleted = []byte("deleted") // время пометки на удаление и короткая ссылка -> пусто
+	bucketPurged  = []byte("purged")  // то же для очищенных удалённых ссылок
+
+	keyURLs   = []byte("urls")
+	keyUsers  = []byte("users")
+	keyIDs    = []byte("ids")    // первый невыданный номер счётчика ссылок
+	keyDedupe = []byte("dedupe") // область уникальности, по которой построен индекс адресов
+)
+
+// ожидание блокировки файла другим процессом
+const openTimeout = time.Second
+
+type BoltStore struct {
+	db    *bolt.DB
+	scope storage.DedupeScope // область уникальности адреса
+}
+
+// Утверждение типа, ошибка компиляции
+var (
+	_ storage.Storage      = (*BoltStore)(nil)
+	_ storage.OriginGetter = (*BoltStore)(nil)
+	_ storage.IDLeaser     = (*BoltStore)(nil)
+)
+
+// Option настройка хранилища
+type Option func(*BoltStore)
+
+// WithDedupe область уникальности полного адреса, по умолчанию storage.DedupeGlobal.
+// При смене области индекс адресов перестраивается при открытии.
+func WithDedupe(scope storage.DedupeScope) Option {
+	return func(s *BoltStore) {
+		s.scope = scope
+	}
+}
+
+// New Функция-конструктор, открывает файл по строке подключения вида bolt://path
+func New(dsn string, opts ...Option) (*BoltStore, error) {
+	path, ok := strings.CutPrefix(dsn, Scheme)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("wrong bolt dsn %q", dsn)
+	}
+
+	s := &BoltStore{scope: storage.DedupeGlobal}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	db, err := bolt.Open(path, 0666, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	// При первом запуске база может быть пустая
+	err = db.Update(func(tx *bolt.Tx) error {
+		// база могла быть создана до появления времени удаления
+		backfill := tx.Bucket(bucketURLs) != nil && tx.Bucket(bucketDeleted) == nil
+
+		for _, name := range [][]byte{bucketURLs, bucketOrigins, bucketUsers, bucketLive, bucketMeta,
+			bucketExpires, bucketDeleted, bucketPurged} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if backfill {
+			if err := backfillDeleted(tx); err != nil {
+				return err
+			}
+		}
+		return reindexOrigins(tx, s.scope)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.db = db
+	return s, nil
+}
+
+// Close Закрытие базы
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping Проверка, что база открыта
+func (s *BoltStore) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// GetAddr Получение полного адреса по короткой ссылке
+func (s *BoltStore) GetAddr(ctx context.Context, short string) (data model.StoreData, err error) {
+	if err = ctx.Err(); err != nil {
+		return model.StoreData{}, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data, err = getData(tx, short)
+		return err
+	})
+	if err != nil {
+		return model.StoreData{}, err
+	}
+	return data, nil
+}
+
+// GetByOrigin Получение ссылки по полному адресу
+func (s *BoltStore) GetByOrigin(ctx context.Context, userID, origin string) (data model.StoreData, err error) {
+	if err = ctx.Err(); err != nil {
+		return model.StoreData{}, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		short := originShort(tx, s.scope, userID, origin)
+		if short == nil {
+			return storage.ErrAddressNotFound
+		}
+		data, err = getData(tx, string(short))
+		return err
+	})
+	if err != nil {
+		return model.StoreData{}, err
+	}
+	return data, nil
+}
+
+// Set Установка уникального соответствия
+func (s *BoltStore) Set(ctx context.Context, data model.StoreData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ok, err := data.IsValid(); !ok {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if originShort(tx, s.scope, data.UserID, data.OriginalURL) != nil {
+			return storage.ErrAddressConflict
+		}
+		if tx.Bucket(bucketURLs).Get([]byte(data.ShortURL)) != nil {
+			return storage.ErrShortConflict
+		}
+		return put(tx, s.scope, data)
+	})
+}
+
+// Update Установка/обновление соответствия между адресом и короткой ссылкой.
+// Все ссылки записываются в одной транзакции.
+func (s *BoltStore) Update(ctx context.Context, list []model.StoreData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, data := range list {
+			// полный адрес уже занят другой ссылкой
+			short := originShort(tx, s.scope, data.UserID, data.OriginalURL)
+			if short != nil && string(short) != data.ShortURL {
+				return storage.ErrAddressConflict
+			}
+			// короткая ссылка занята другим адресом или владельцем
+			old, err := getData(tx, data.ShortURL)
+			if err == nil && s.scope.Taken(old, data) {
+				return storage.ErrShortConflict
+			} else if err != nil && !errors.Is(err, storage.ErrAddressNotFound) {
+				return err
+			}
+			if err := put(tx, s.scope, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetUserURLs Получение данных пользователя
+func (s *BoltStore) GetUserURLs(ctx context.Context, userID string) ([]model.StoreData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make([]model.StoreData, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachUserShort(tx.Bucket(bucketUsers), userID, func(short []byte) error {
+			data, err := getData(tx, string(short))
+			if err != nil {
+				return err
+			}
+			res = append(res, data)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteShort Пометка на удаление указанных сокращённых ссылок
+func (s *BoltStore) DeleteShort(ctx context.Context, shortURLs []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, short := range shortURLs {
+			if err := markDeleted(tx, short); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteUserShort Пометка на удаление ссылок пользователя
+func (s *BoltStore) DeleteUserShort(ctx context.Context, userID string, shortURLs []string) (shorts []string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		shorts = nil
+		seen := make(map[string]bool, len(shortURLs))
+		for _, short := range shortURLs {
+			data, err := getData(tx, short)
+			if errors.Is(err, storage.ErrAddressNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if data.UserID != userID || data.DeletedFlag || seen[short] {
+				continue
+			}
+
+			if err = markDeleted(tx, short); err != nil {
+				return err
+			}
+			seen[short] = true
+			shorts = append(shorts, short)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// RestoreShort Снятие пометки на удаление с неочищенных ссылок пользователя
+func (s *BoltStore) RestoreShort(ctx context.Context, userID string, shortURLs []string) (shorts []string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		shorts = nil
+		for _, short := range shortURLs {
+			data, err := getData(tx, short)
+			if errors.Is(err, storage.ErrAddressNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if data.UserID != userID || !data.DeletedFlag || data.Purged() {
+				continue
+			}
+
+			if err = count(tx, data, -1); err != nil {
+				return err
+			}
+			data.DeletedFlag = false
+			data.DeletedAt = nil
+			if err = count(tx, data, 1); err != nil {
+				return err
+			}
+			if err = putJSON(tx.Bucket(bucketURLs), []byte(short), data); err != nil {
+				return err
+			}
+			shorts = append(shorts, short)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// DeleteExpired Пометка на удаление ссылок с истёкшим сроком по индексу сроков
+func (s *BoltStore) DeleteExpired(ctx context.Context, now time.Time, limit int) (shorts []string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		// ключи упорядочены по сроку, обход до первого неистёкшего
+		shorts = nil
+		c := tx.Bucket(bucketExpires).Cursor()
+		for k, _ := c.First(); k != nil && !keyTime(k).After(now); k, _ = c.Next() {
+			if limit > 0 && len(shorts) == limit {
+				break
+			}
+			shorts = append(shorts, string(k[8:]))
+		}
+
+		// удаление меняет индекс, поэтому не во время обхода
+		for _, short := range shorts {
+			if err := markDeleted(tx, short); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// PurgeDeleted Окончательное удаление ссылок по индексу времени пометки на удаление.
+// Очищенные ссылки лежат в отдельном индексе и без free не перебираются.
+func (s *BoltStore) PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) (shorts []string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	buckets := [][]byte{bucketDeleted}
+	if free {
+		buckets = append(buckets, bucketPurged)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		shorts = nil
+		for _, name := range buckets {
+			c := tx.Bucket(name).Cursor()
+			for k, _ := c.First(); k != nil && !keyTime(k).After(before); k, _ = c.Next() {
+				if limit > 0 && len(shorts) == limit {
+					break
+				}
+				shorts = append(shorts, string(k[8:]))
+			}
+		}
+
+		for _, short := range shorts {
+			if err := purge(tx, s.scope, short, free); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// Stats Количество неудалённых ссылок и их пользователей из счётчиков, без обхода ссылок
+func (s *BoltStore) Stats(ctx context.Context) (URLs int, users int, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		URLs = int(getCounter(meta, keyURLs))
+		users = int(getCounter(meta, keyUsers))
+		return nil
+	})
+	return
+}
+
+// LeaseIDs блок из n номеров счётчика ссылок.
+// Граница хранится в счётчиках и фиксируется транзакцией до выдачи блока.
+func (s *BoltStore) LeaseIDs(ctx context.Context, n uint64) (start uint64, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(bucketMeta)
+		start = uint64(getCounter(meta, keyIDs))
+		if n == 0 || start+n < start {
+			return errors.New("wrong id block size")
+		}
+		return addCounter(meta, keyIDs, int64(n))
+	})
+	return
+}
+
+// чтение данных ссылки
+func getData(tx *bolt.Tx, short string) (model.StoreData, error) {
+	v := tx.Bucket(bucketURLs).Get([]byte(short))
+	if v == nil {
+		return model.StoreData{}, storage.ErrAddressNotFound
+	}
+
+	var data model.StoreData
+	if err := json.Unmarshal(v, &data); err != nil {
+		return model.StoreData{}, fmt.Errorf("error decode %q: %w", short, err)
+	}
+	return data, nil
+}
+
+// Пометка ссылки на удаление, отсутствующие и удалённые пропускаются
+func markDeleted(tx *bolt.Tx, short string) error {
+	data, err := getData(tx, short)
+	if errors.Is(err, storage.ErrAddressNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if data.DeletedFlag {
+		return nil
+	}
+
+	if err = count(tx, data, -1); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	data.DeletedFlag = true
+	data.DeletedAt = &now
+	if err = count(tx, data, 1); err != nil {
+		return err
+	}
+	return putJSON(tx.Bucket(bucketURLs), []byte(short), data)
+}
+
+// Очистка данных удалённой ссылки, с free - удаление вместе с короткой ссылкой
+func purge(tx *bolt.Tx, scope storage.DedupeScope, short string, free bool) error {
+	data, err := getData(tx, short)
+	if err != nil {
+		return err
+	}
+	if err = count(tx, data, -1); err != nil {
+		return err
+	}
+
+	if !data.Purged() {
+		if err = unlinkOrigin(tx, scope, data); err != nil {
+			return err
+		}
+		if err = tx.Bucket(bucketUsers).Delete(userKey(data.UserID, []byte(short))); err != nil {
+			return err
+		}
+	}
+	if free {
+		return tx.Bucket(bucketURLs).Delete([]byte(short))
+	}
+
+	data = model.StoreData{
+		ID:          data.ID,
+		ShortURL:    short,
+		DeletedFlag: true,
+		DeletedAt:   data.DeletedAt,
+	}
+	if err = count(tx, data, 1); err != nil {
+		return err
+	}
+	return putJSON(tx.Bucket(bucketURLs), []byte(short), data)
+}
+
+// короткая ссылка, которой занят адрес в области уникальности, или nil
+func originShort(tx *bolt.Tx, scope storage.DedupeScope, userID, origin string) []byte {
+	key, ok := scope.OriginKey(userID, origin)
+	if !ok {
+		return nil
+	}
+	return tx.Bucket(bucketOrigins).Get([]byte(key))
+}
+
+// снятие адреса со ссылки data, если он занят именно ей
+func unlinkOrigin(tx *bolt.Tx, scope storage.DedupeScope, data model.StoreData) error {
+	key, ok := scope.OriginKey(data.UserID, data.OriginalURL)
+	if !ok {
+		return nil
+	}
+	origins := tx.Bucket(bucketOrigins)
+	if string(origins.Get([]byte(key))) != data.ShortURL {
+		return nil
+	}
+	return origins.Delete([]byte(key))
+}
+
+// Перестроение индекса адресов, если база открыта с другой областью уникальности.
+// База без отметки области построена по общей уникальности.
+// При переходе к более строгой области повтор адреса - ошибка, база не меняется.
+func reindexOrigins(tx *bolt.Tx, scope storage.DedupeScope) error {
+	meta := tx.Bucket(bucketMeta)
+	stored := storage.DedupeScope(meta.Get(keyDedupe))
+	if stored == "" {
+		stored = storage.DedupeGlobal
+	}
+	if stored == scope {
+		return nil
+	}
+
+	if err := tx.DeleteBucket(bucketOrigins); err != nil {
+		return err
+	}
+	origins, err := tx.CreateBucket(bucketOrigins)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(bucketURLs).ForEach(func(k, v []byte) error {
+		var data model.StoreData
+		if err := json.Unmarshal(v, &data); err != nil {
+			return fmt.Errorf("error decode %q: %w", k, err)
+		}
+		key, ok := scope.OriginKey(data.UserID, data.OriginalURL)
+		if !ok || data.Purged() {
+			return nil
+		}
+		if origins.Get([]byte(key)) != nil {
+			return fmt.Errorf("address %q is shortened twice, cannot dedupe by %s", data.OriginalURL, scope)
+		}
+		return origins.Put([]byte(key), k)
+	})
+	if err != nil {
+		return err
+	}
+	return meta.Put(keyDedupe, []byte(scope))
+}
+
+// Время удаления для ссылок, удалённых до его появления, и индекс по нему
+func backfillDeleted(tx *bolt.Tx) error {
+	now := time.Now().UTC()
+	urls := tx.Bucket(bucketURLs)
+
+	var list []model.StoreData
+	err := urls.ForEach(func(k, v []byte) error {
+		var data model.StoreData
+		if err := json.Unmarshal(v, &data); err != nil {
+			return fmt.Errorf("error decode %q: %w", k, err)
+		}
+		if data.DeletedFlag && data.DeletedAt == nil {
+			data.DeletedAt = &now
+			list = append(list, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// запись меняет корзину, поэтому не во время обхода
+	for _, data := range list {
+		if err = count(tx, data, 1); err != nil {
+			return err
+		}
+		if err = putJSON(urls, []byte(data.ShortURL), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Запись ссылки с поддержкой вторичных индексов и счётчиков.
+// Вызывается внутри транзакции записи.
+func put(tx *bolt.Tx, scope storage.DedupeScope, data model.StoreData) error {
+	urls := tx.Bucket(bucketURLs)
+	short := []byte(data.ShortURL)
+
+	old, err := getData(tx, data.ShortURL)
+	switch {
+	case err == nil:
+		if old.ID != "" && data.ID == "" {
+			data.ID = old.ID
+		}
+		if !old.Purged() {
+			if err = unlinkOrigin(tx, scope, old); err != nil {
+				return err
+			}
+		}
+		if old.UserID != data.UserID {
+			if err = tx.Bucket(bucketUsers).Delete(userKey(old.UserID, short)); err != nil {
+				return err
+			}
+		}
+		if err = count(tx, old, -1); err != nil {
+			return err
+		}
+	case errors.Is(err, storage.ErrAddressNotFound):
+	default:
+		return err
+	}
+	if err = count(tx, data, 1); err != nil {
+		return err
+	}
+
+	if data.ID == "" {
+		id, err := urls.NextSequence()
+		if err != nil {
+			return err
+		}
+		data.ID = strconv.FormatUint(id, 10)
+	}
+
+	if err = putJSON(urls, short, data); err != nil {
+		return err
+	}
+	if key, ok := scope.OriginKey(data.UserID, data.OriginalURL); ok {
+		if err = tx.Bucket(bucketOrigins).Put([]byte(key), short); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketUsers).Put(userKey(data.UserID, short), []byte{})
+}
+
+// Учёт неудалённой ссылки в счётчиках статистики и индексе сроков,
+// удалённой - в индексе времени удаления.
+// Пользователь учитывается, пока у него есть неудалённые ссылки.
+func count(tx *bolt.Tx, data model.StoreData, delta int64) error {
+	if data.DeletedFlag {
+		return countDeleted(tx, data, delta)
+	}
+	// срок действия нужен только неудалённым ссылкам
+	if data.ExpiresAt != nil {
+		key := timeKey(*data.ExpiresAt, data.ShortURL)
+		var err error
+		if delta > 0 {
+			err = tx.Bucket(bucketExpires).Put(key, []byte{})
+		} else {
+			err = tx.Bucket(bucketExpires).Delete(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	meta := tx.Bucket(bucketMeta)
+	if err := addCounter(meta, keyURLs, delta); err != nil {
+		return err
+	}
+
+	live := tx.Bucket(bucketLive)
+	key := liveKey(data.UserID)
+	n := getCounter(live, key)
+	switch {
+	case n == 0 && delta > 0:
+		if err := addCounter(meta, keyUsers, 1); err != nil {
+			return err
+		}
+	case n+delta == 0:
+		if err := addCounter(meta, keyUsers, -1); err != nil {
+			return err
+		}
+		return live.Delete(key)
+	}
+	return addCounter(live, key, delta)
+}
+
+// учёт удалённой ссылки в индексе времени удаления, очищенной - в своём индексе
+func countDeleted(tx *bolt.Tx, data model.StoreData, delta int64) error {
+	if data.DeletedAt == nil {
+		return nil
+	}
+	b := tx.Bucket(bucketDeleted)
+	if data.Purged() {
+		b = tx.Bucket(bucketPurged)
+	}
+
+	key := timeKey(*data.DeletedAt, data.ShortURL)
+	if delta > 0 {
+		return b.Put(key, []byte{})
+	}
+	return b.Delete(key)
+}
+
+// Ключ индекса по времени: время в наносекундах big-endian, затем короткая ссылка.
+// Так ключи упорядочены по времени.
+func timeKey(t time.Time, short string) []byte {
+	key := make([]byte, 8, 8+len(short))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, short...)
+}
+
+// время из ключа индекса по времени
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+// ключ счётчика пользователя, пустой ключ bbolt не допускает
+func liveKey(userID string) []byte {
+	return append([]byte{'u'}, userID...)
+}
+
+// Ключ набора пользователя: идентификатор, разделитель, короткая ссылка.
+// Идентификатор может быть пустым, поэтому не вложенные корзины.
+func userKey(userID string, short []byte) []byte {
+	key := make([]byte, 0, len(userID)+1+len(short))
+	key = append(key, userID...)
+	key = append(key, 0)
+	return append(key, short...)
+}
+
+// обход коротких ссылок пользователя
+func forEachUserShort(users *bolt.Bucket, userID string, fn func(short []byte) error) error {
+	prefix := userKey(userID, nil)
+	c := users.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		if err := fn(k[len(prefix):]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putJSON(b *bolt.Bucket, key []byte, data model.StoreData) error {
+	v, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, v)
+}
+
+func getCounter(b *bolt.Bucket, key []byte) int64 {
+	v := b.Get(key)
+	if len(v) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func addCounter(b *bolt.Bucket, key []byte, delta int64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(getCounter(b, key)+delta))
+	return b.Put(key, v)
+}
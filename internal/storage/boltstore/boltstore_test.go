@@ -0,0 +1,194 @@
+// Тестирование хранилища bbolt
+
+package boltstore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/storagetest"
+)
+
+func newTestStore(t *testing.T) *BoltStore {
+	store, err := New(Scheme + filepath.Join(t.TempDir(), "short-url.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("postgres://localhost")
+	require.Error(t, err)
+
+	_, err = New(Scheme)
+	require.Error(t, err)
+
+	_, err = New(Scheme + filepath.Join(t.TempDir(), "none", "short-url.db"))
+	require.Error(t, err)
+}
+
+func TestPersist(t *testing.T) {
+	dsn := Scheme + filepath.Join(t.TempDir(), "short-url.db")
+	ctx := context.Background()
+
+	store, err := New(dsn)
+	require.NoError(t, err)
+
+	data := model.StoreData{UserID: "user", ShortURL: "short", OriginalURL: "ya.ru"}
+	require.NoError(t, store.Set(ctx, data))
+	require.NoError(t, store.DeleteShort(ctx, []string{"short"}))
+	require.NoError(t, store.Close())
+
+	store, err = New(dsn)
+	require.NoError(t, err)
+	defer store.Close()
+
+	get, err := store.GetAddr(ctx, "short")
+	require.NoError(t, err)
+	require.NotNil(t, get.DeletedAt)
+	get.DeletedAt = nil
+	data.ID = "1"
+	data.DeletedFlag = true
+	assert.Equal(t, data, get)
+
+	// счётчики сохраняются вместе с данными
+	urls, users, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, urls)
+	assert.Equal(t, 0, users)
+
+	require.NoError(t, store.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "short", OriginalURL: "ya.ru"},
+	}))
+	urls, users, err = store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, urls)
+	assert.Equal(t, 1, users)
+}
+
+func TestBackfillDeleted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short-url.db")
+	ctx := context.Background()
+
+	// база прежней версии без времени удаления
+	db, err := bolt.Open(path, 0666, nil)
+	require.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		urls, err := tx.CreateBucket(bucketURLs)
+		if err != nil {
+			return err
+		}
+		return putJSON(urls, []byte("short"), model.StoreData{
+			ID: "1", UserID: "user", ShortURL: "short", OriginalURL: "ya.ru", DeletedFlag: true})
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	store, err := New(Scheme + path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	get, err := store.GetAddr(ctx, "short")
+	require.NoError(t, err)
+	require.NotNil(t, get.DeletedAt)
+
+	purged, err := store.PurgeDeleted(ctx, time.Now().Add(time.Hour), 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"short"}, purged)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				err := store.Set(ctx, model.StoreData{
+					UserID:      fmt.Sprint(w),
+					ShortURL:    fmt.Sprintf("s%d-%d", w, i),
+					OriginalURL: fmt.Sprintf("http://%d.ru/%d", w, i),
+				})
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	urls, users, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 160, urls)
+	assert.Equal(t, 8, users)
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newTestStore(t)
+	})
+}
+
+func TestStorageDedupe(t *testing.T) {
+	storagetest.RunDedupe(t, func(t *testing.T, scope storage.DedupeScope) storage.Storage {
+		store, err := New(Scheme+filepath.Join(t.TempDir(), "short-url.db"), WithDedupe(scope))
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+// индекс адресов перестраивается при смене области уникальности
+func TestReindexOrigins(t *testing.T) {
+	dsn := Scheme + filepath.Join(t.TempDir(), "short-url.db")
+	ctx := context.Background()
+
+	store, err := New(dsn, WithDedupe(storage.DedupeUser))
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "a", ShortURL: "s1", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "b", ShortURL: "s2", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "a", ShortURL: "s3", OriginalURL: "go.dev"}))
+	require.NoError(t, store.Close())
+
+	// адрес сокращён дважды, общая уникальность невозможна
+	_, err = New(dsn, WithDedupe(storage.DedupeGlobal))
+	require.Error(t, err)
+
+	store, err = New(dsn, WithDedupe(storage.DedupeNone))
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "a", ShortURL: "s4", OriginalURL: "go.dev"}))
+	require.NoError(t, store.Close())
+
+	_, err = New(dsn, WithDedupe(storage.DedupeUser))
+	require.Error(t, err, "go.dev twice for user a")
+
+	// без повторов переход к пользовательской области снова возможен
+	store, err = New(dsn, WithDedupe(storage.DedupeNone))
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteShort(ctx, []string{"s4"}))
+	_, err = store.PurgeDeleted(ctx, time.Now().Add(time.Hour), 0, true)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = New(dsn, WithDedupe(storage.DedupeUser))
+	require.NoError(t, err)
+	defer store.Close()
+
+	get, err := store.GetByOrigin(ctx, "b", "ya.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "s2", get.ShortURL)
+	get, err = store.GetByOrigin(ctx, "a", "go.dev")
+	require.NoError(t, err)
+	assert.Equal(t, "s3", get.ShortURL)
+}
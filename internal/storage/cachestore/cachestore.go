@@ -0,0 +1,323 @@
+// Кеширование переходов по коротким ссылкам поверх любого хранилища
+package cachestore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// Настройки по умолчанию
+const (
+	DefaultSize        = 10000
+	DefaultTTL         = 5 * time.Minute
+	DefaultNegativeTTL = 10 * time.Second
+	DefaultReplicaLag  = 10 * time.Second
+)
+
+// сколько записей о ссылках держать без очистки устаревших
+const minKeysTrim = 1024
+
+// CacheStore хранилище с кешем GetAddr.
+// Кешируются и найденные ссылки, и отсутствующие.
+// Кеш заполняется чтением в сессии запроса, только недавно
+// сброшенные ссылки читаются с основной базы: отстающая реплика
+// вернула бы в кеш старую версию на всё время жизни.
+// Запись через кеш сбрасывает затронутые ссылки.
+type CacheStore struct {
+	store storage.Storage
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+	replicaLag  time.Duration
+	now         func() time.Time
+
+	mx       sync.Mutex
+	cache    *lru
+	epoch    uint64               // растёт при сбросе всего кеша
+	keys     map[string]*keyState // ссылки с начатым заполнением или недавним сбросом
+	keysTrim int                  // размер keys, при котором удаляются устаревшие записи
+
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+	evictions    atomic.Int64
+}
+
+// Состояние ссылки для заполнения кеша
+type keyState struct {
+	gen   uint64    // поколение ссылки, растёт при каждом её сбросе
+	fills int       // начатые заполнения
+	dirty time.Time // до этого времени ссылка читается с основной базы
+}
+
+// Утверждение типа, ошибка компиляции
+var (
+	_ storage.Storage     = (*CacheStore)(nil)
+	_ storage.Invalidator = (*CacheStore)(nil)
+)
+
+// Option настройка кеша
+type Option func(*CacheStore)
+
+// WithSize максимальное количество ссылок в кеше
+func WithSize(size int) Option {
+	return func(c *CacheStore) {
+		if size > 0 {
+			c.cache = newLRU(size)
+		}
+	}
+}
+
+// WithTTL время жизни найденной ссылки в кеше
+func WithTTL(ttl time.Duration) Option {
+	return func(c *CacheStore) {
+		c.ttl = ttl
+	}
+}
+
+// WithNegativeTTL время жизни отметки об отсутствии ссылки, 0 - не кешировать
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *CacheStore) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithReplicaLag сколько после сброса ссылка читается с основной базы,
+// а не с реплики, 0 - только в сессии с записью
+func WithReplicaLag(lag time.Duration) Option {
+	return func(c *CacheStore) {
+		c.replicaLag = lag
+	}
+}
+
+// New обёртка хранилища кешем
+func New(store storage.Storage, opts ...Option) *CacheStore {
+	c := &CacheStore{
+		store:       store,
+		ttl:         DefaultTTL,
+		negativeTTL: DefaultNegativeTTL,
+		replicaLag:  DefaultReplicaLag,
+		now:         time.Now,
+		cache:       newLRU(DefaultSize),
+		keys:        make(map[string]*keyState),
+		keysTrim:    minKeysTrim,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Unwrap обёрнутое хранилище
+func (c *CacheStore) Unwrap() storage.Storage {
+	return c.store
+}
+
+// Close закрытие обёрнутого хранилища
+func (c *CacheStore) Close() error {
+	return c.store.Close()
+}
+
+// Ping проверка обёрнутого хранилища
+func (c *CacheStore) Ping(ctx context.Context) error {
+	return c.store.Ping(ctx)
+}
+
+// GetAddr полный адрес из кеша или из хранилища
+func (c *CacheStore) GetAddr(ctx context.Context, short string) (model.StoreData, error) {
+	now := c.now()
+
+	c.mx.Lock()
+	e, ok := c.cache.get(short)
+	if ok && now.After(e.expires) {
+		c.cache.remove(short)
+		ok = false
+	}
+	if ok {
+		c.mx.Unlock()
+		c.hits.Add(1)
+		if !e.found {
+			c.negativeHits.Add(1)
+			return model.StoreData{}, storage.ErrAddressNotFound
+		}
+		return e.data, nil
+	}
+
+	ks := c.keys[short]
+	if ks == nil {
+		ks = &keyState{}
+		c.keys[short] = ks
+	}
+	ks.fills++
+	gen, epoch := ks.gen, c.epoch
+	if now.Before(ks.dirty) {
+		ctx = storage.WithPrimary(ctx)
+	}
+	c.mx.Unlock()
+
+	c.misses.Add(1)
+	data, err := c.store.GetAddr(ctx, short)
+
+	var fill *entry
+	switch {
+	case err == nil:
+		fill = &entry{short: short, data: data, found: true, expires: now.Add(c.ttl)}
+	case errors.Is(err, storage.ErrAddressNotFound) && c.negativeTTL > 0:
+		fill = &entry{short: short, expires: now.Add(c.negativeTTL)}
+	}
+	c.put(short, ks, gen, epoch, fill)
+	return data, err
+}
+
+// Set запись в хранилище, отметка об отсутствии ссылки сбрасывается
+func (c *CacheStore) Set(ctx context.Context, data model.StoreData) error {
+	defer c.Invalidate(data.ShortURL)
+	return c.store.Set(ctx, data)
+}
+
+// Update запись в хранилище со сбросом затронутых ссылок
+func (c *CacheStore) Update(ctx context.Context, list []model.StoreData) error {
+	shorts := make([]string, len(list))
+	for i, d := range list {
+		shorts[i] = d.ShortURL
+	}
+	defer c.Invalidate(shorts...)
+	return c.store.Update(ctx, list)
+}
+
+// GetUserURLs ссылки пользователя из хранилища
+func (c *CacheStore) GetUserURLs(ctx context.Context, userID string) ([]model.StoreData, error) {
+	return c.store.GetUserURLs(ctx, userID)
+}
+
+// DeleteShort удаление в хранилище со сбросом удалённых ссылок
+func (c *CacheStore) DeleteShort(ctx context.Context, shortURLs []string) error {
+	defer c.Invalidate(shortURLs...)
+	return c.store.DeleteShort(ctx, shortURLs)
+}
+
+// DeleteUserShort удаление ссылок пользователя в хранилище со сбросом удалённых
+func (c *CacheStore) DeleteUserShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	shorts, err := c.store.DeleteUserShort(ctx, userID, shortURLs)
+	c.Invalidate(shorts...)
+	return shorts, err
+}
+
+// RestoreShort восстановление в хранилище со сбросом восстановленных ссылок
+func (c *CacheStore) RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	shorts, err := c.store.RestoreShort(ctx, userID, shortURLs)
+	c.Invalidate(shorts...)
+	return shorts, err
+}
+
+// DeleteExpired удаление истёкших ссылок в хранилище со сбросом удалённых
+func (c *CacheStore) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	shorts, err := c.store.DeleteExpired(ctx, now, limit)
+	c.Invalidate(shorts...)
+	return shorts, err
+}
+
+// PurgeDeleted окончательное удаление с очисткой кеша от удалённых ссылок
+func (c *CacheStore) PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) ([]string, error) {
+	shorts, err := c.store.PurgeDeleted(ctx, before, limit, free)
+	c.Invalidate(shorts...)
+	return shorts, err
+}
+
+// Stats статистика хранилища
+func (c *CacheStore) Stats(ctx context.Context) (URLs int, users int, err error) {
+	return c.store.Stats(ctx)
+}
+
+// Invalidate сброс ссылок из кеша.
+// Запросы к хранилищу за этими ссылками, начатые до сброса,
+// кеш уже не заполнят, остальные ссылки сброс не задевает.
+func (c *CacheStore) Invalidate(shorts ...string) {
+	now := c.now()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for _, short := range shorts {
+		c.cache.remove(short)
+
+		ks := c.keys[short]
+		if ks == nil {
+			if c.replicaLag <= 0 {
+				continue
+			}
+			ks = &keyState{}
+			c.keys[short] = ks
+		}
+		ks.gen++
+		ks.dirty = now.Add(c.replicaLag)
+	}
+	c.trimKeys(now)
+}
+
+// InvalidateAll сброс всего кеша
+func (c *CacheStore) InvalidateAll() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.cache = newLRU(c.cache.size)
+	c.epoch++
+}
+
+// CacheStats счётчики кеша
+func (c *CacheStore) CacheStats() model.CacheStats {
+	c.mx.Lock()
+	size, capacity := c.cache.len(), c.cache.size
+	c.mx.Unlock()
+
+	return model.CacheStats{
+		Size:         size,
+		Capacity:     capacity,
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.evictions.Load(),
+	}
+}
+
+// Завершение заполнения: запись в кеш, если с начала запроса
+// к хранилищу ни ссылку, ни весь кеш не сбрасывали
+func (c *CacheStore) put(short string, ks *keyState, gen, epoch uint64, e *entry) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	ks.fills--
+	if ks.fills == 0 && !c.now().Before(ks.dirty) && c.keys[short] == ks {
+		delete(c.keys, short)
+	}
+	if e == nil || ks.gen != gen || c.epoch != epoch {
+		return
+	}
+	if n := c.cache.add(e); n > 0 {
+		c.evictions.Add(int64(n))
+	}
+}
+
+// Удаление записей о ссылках без заполнений с истёкшим чтением
+// с основной базы. Выполняется, когда записей стало вдвое больше,
+// чем после прошлой очистки. Вызывается под блокировкой.
+func (c *CacheStore) trimKeys(now time.Time) {
+	if len(c.keys) < c.keysTrim {
+		return
+	}
+	for short, ks := range c.keys {
+		if ks.fills == 0 && !now.Before(ks.dirty) {
+			delete(c.keys, short)
+		}
+	}
+	c.keysTrim = 2 * len(c.keys)
+	if c.keysTrim < minKeysTrim {
+		c.keysTrim = minKeysTrim
+	}
+}
@@ -0,0 +1,344 @@
+// Тестирование кеша переходов
+
+package cachestore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/memstore"
+	"github.com/eugene982/url-shortener/internal/storage/storagetest"
+)
+
+// хранилище со счётчиком обращений за ссылками
+type countingStore struct {
+	storage.Storage
+	gets int
+	// вызывается внутри GetAddr до чтения, для имитации гонки
+	beforeGet func()
+}
+
+func (s *countingStore) GetAddr(ctx context.Context, short string) (model.StoreData, error) {
+	s.gets++
+	if s.beforeGet != nil {
+		s.beforeGet()
+	}
+	return s.Storage.GetAddr(ctx, short)
+}
+
+func newTestStore(t *testing.T, opts ...Option) (*CacheStore, *countingStore) {
+	mem, err := memstore.New("")
+	require.NoError(t, err)
+	counting := &countingStore{Storage: mem}
+
+	c := New(counting, opts...)
+	t.Cleanup(func() { c.Close() })
+	return c, counting
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		c, _ := newTestStore(t)
+		return c
+	})
+}
+
+func TestGetAddr(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t)
+
+	data := model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "http://ya.ru"}
+	require.NoError(t, c.Set(ctx, data))
+
+	for i := 0; i < 3; i++ {
+		got, err := c.GetAddr(ctx, "s1")
+		require.NoError(t, err)
+		assert.Equal(t, data.OriginalURL, got.OriginalURL)
+	}
+	assert.Equal(t, 1, inner.gets)
+
+	// отсутствие ссылки тоже кешируется
+	for i := 0; i < 3; i++ {
+		_, err := c.GetAddr(ctx, "none")
+		require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	}
+	assert.Equal(t, 2, inner.gets)
+
+	assert.Equal(t, model.CacheStats{
+		Size:         2,
+		Capacity:     DefaultSize,
+		Hits:         4,
+		NegativeHits: 2,
+		Misses:       2,
+	}, c.CacheStats())
+}
+
+func TestInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t)
+
+	// прочитанная до записи отметка об отсутствии сбрасывается записью
+	_, err := c.GetAddr(ctx, "s1")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	require.NoError(t, c.Set(ctx, model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "http://a.ru"}))
+
+	got, err := c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://a.ru", got.OriginalURL)
+
+	require.NoError(t, c.Update(ctx, []model.StoreData{{UserID: "u2", ShortURL: "s1", OriginalURL: "http://a.ru"}}))
+	got, err = c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "u2", got.UserID)
+
+	require.NoError(t, c.DeleteShort(ctx, []string{"s1"}))
+	got, err = c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+
+	assert.Equal(t, 4, inner.gets)
+}
+
+func TestInvalidateAll(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t, WithSize(10))
+
+	for _, short := range []string{"s1", "s2"} {
+		_, err := c.GetAddr(ctx, short)
+		require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	}
+	require.Equal(t, 2, c.CacheStats().Size)
+
+	c.InvalidateAll()
+	st := c.CacheStats()
+	assert.Equal(t, 0, st.Size)
+	assert.Equal(t, 10, st.Capacity)
+
+	_, err := c.GetAddr(ctx, "s1")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	assert.Equal(t, 3, inner.gets)
+}
+
+func TestStaleFill(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t)
+
+	require.NoError(t, c.Set(ctx, model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "http://a.ru"}))
+
+	// ссылку удаляют, пока чтение уже ушло в хранилище со старыми данными
+	inner.beforeGet = func() {
+		inner.beforeGet = nil
+		c.Invalidate("s1")
+	}
+	got, err := c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://a.ru", got.OriginalURL)
+
+	// начатое до сброса чтение в кеш не попало
+	assert.Equal(t, 0, c.CacheStats().Size)
+}
+
+// хранилище с отстающей репликой: без чтения с основной базы
+// возвращается старая версия ссылки
+type laggingStore struct {
+	storage.Storage
+	replica map[string]model.StoreData
+}
+
+func (s *laggingStore) GetAddr(ctx context.Context, short string) (model.StoreData, error) {
+	if data, ok := s.replica[short]; ok && !storage.Written(ctx) {
+		return data, nil
+	}
+	return s.Storage.GetAddr(ctx, short)
+}
+
+func TestStaleReplica(t *testing.T) {
+	ctx := context.Background()
+	mem, err := memstore.New("")
+	require.NoError(t, err)
+	lagging := &laggingStore{Storage: mem, replica: make(map[string]model.StoreData)}
+	c := New(lagging, WithReplicaLag(time.Second))
+	defer c.Close()
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	data := model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "http://a.ru"}
+	require.NoError(t, c.Set(ctx, data))
+	_, err = c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+
+	// удаление на основной базе, реплика его ещё не получила
+	require.NoError(t, mem.DeleteShort(ctx, []string{"s1"}))
+	lagging.replica["s1"] = data
+	c.Invalidate("s1")
+
+	// недавно сброшенная ссылка читается с основной базы
+	for i := 0; i < 2; i++ {
+		got, err := c.GetAddr(ctx, "s1")
+		require.NoError(t, err)
+		assert.True(t, got.DeletedFlag)
+	}
+
+	// остальные ссылки читаются с реплики
+	old := model.StoreData{UserID: "u1", ShortURL: "s2", OriginalURL: "http://b.ru"}
+	lagging.replica["s2"] = old
+	got, err := c.GetAddr(ctx, "s2")
+	require.NoError(t, err)
+	assert.Equal(t, old, got)
+
+	// и после окна отставания реплики
+	now = now.Add(2 * time.Second)
+	c.Invalidate("s2")
+	now = now.Add(2 * time.Second)
+	got, err = c.GetAddr(ctx, "s2")
+	require.NoError(t, err)
+	assert.Equal(t, old, got)
+	assert.NotContains(t, c.keys, "s2")
+
+	// кроме сессии, в которой была запись
+	c.InvalidateAll()
+	session := storage.WithSession(ctx)
+	storage.MarkWritten(session)
+	_, err = c.GetAddr(session, "s2")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+}
+
+func TestFillOtherInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t)
+
+	require.NoError(t, c.Set(ctx, model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "http://a.ru"}))
+
+	// сброс другой ссылки во время чтения не мешает заполнению
+	inner.beforeGet = func() {
+		inner.beforeGet = nil
+		c.Invalidate("s2")
+	}
+	_, err := c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.CacheStats().Size)
+
+	// а сброс всего кеша мешает
+	c.InvalidateAll()
+	inner.beforeGet = func() {
+		inner.beforeGet = nil
+		c.InvalidateAll()
+	}
+	_, err = c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.CacheStats().Size)
+}
+
+func TestInvalidateTrim(t *testing.T) {
+	c, _ := newTestStore(t, WithReplicaLag(time.Second))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < minKeysTrim; i++ {
+		c.Invalidate(fmt.Sprint("s", i))
+	}
+	assert.Len(t, c.keys, minKeysTrim)
+
+	// записи с истёкшим окном отставания удаляются при росте
+	now = now.Add(2 * time.Second)
+	for i := 0; i < minKeysTrim; i++ {
+		c.Invalidate(fmt.Sprint("n", i))
+	}
+	assert.Len(t, c.keys, minKeysTrim)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t, WithTTL(time.Minute), WithNegativeTTL(time.Second))
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Set(ctx, model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "http://a.ru"}))
+	_, err := c.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	_, err = c.GetAddr(ctx, "none")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	assert.Equal(t, 2, inner.gets)
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		gets  int
+	}{
+		{"fresh", 500 * time.Millisecond, 2},
+		{"negative_expired", 2 * time.Second, 3},
+		{"all_expired", 2 * time.Minute, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.after)
+			_, err := c.GetAddr(ctx, "s1")
+			require.NoError(t, err)
+			_, err = c.GetAddr(ctx, "none")
+			require.ErrorIs(t, err, storage.ErrAddressNotFound)
+			assert.Equal(t, tt.gets, inner.gets)
+		})
+	}
+
+	// без времени жизни отсутствие ссылки не кешируется
+	c, inner = newTestStore(t, WithNegativeTTL(0))
+	for i := 0; i < 2; i++ {
+		_, err = c.GetAddr(ctx, "none")
+		require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	}
+	assert.Equal(t, 2, inner.gets)
+}
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	c, inner := newTestStore(t, WithSize(2))
+
+	get := func(short string) {
+		_, err := c.GetAddr(ctx, short)
+		require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	}
+
+	get("s1")
+	get("s2")
+	get("s1") // s1 становится недавней
+	get("s3") // вытесняет s2
+	assert.Equal(t, 3, inner.gets)
+
+	get("s1")
+	assert.Equal(t, 3, inner.gets)
+	get("s2")
+	assert.Equal(t, 4, inner.gets)
+
+	st := c.CacheStats()
+	assert.Equal(t, 2, st.Size)
+	assert.Equal(t, 2, st.Capacity)
+	assert.Equal(t, int64(2), st.Evictions)
+}
+
+func BenchmarkGetAddr(b *testing.B) {
+	ctx := context.Background()
+	mem, err := memstore.New("")
+	require.NoError(b, err)
+	c := New(mem)
+	defer c.Close()
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(b, c.Set(ctx, model.StoreData{
+			UserID: "u", ShortURL: fmt.Sprint(i), OriginalURL: fmt.Sprintf("http://%d.ru", i),
+		}))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.GetAddr(ctx, fmt.Sprint(i%1000))
+	}
+}
@@ -0,0 +1,73 @@
+package cachestore
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// запись кеша: найденная ссылка или отметка об её отсутствии
+type entry struct {
+	short   string
+	data    model.StoreData
+	found   bool
+	expires time.Time
+}
+
+// Вытеснение давно не использованных записей при превышении размера.
+// Не потокобезопасно, блокировка на стороне CacheStore.
+type lru struct {
+	size  int
+	order *list.List // от недавних к давним
+	items map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// запись по ключу, использованная запись становится самой недавней
+func (c *lru) get(short string) (*entry, bool) {
+	el, ok := c.items[short]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry), true
+}
+
+// добавление или замена записи, возвращает количество вытесненных
+func (c *lru) add(e *entry) (evicted int) {
+	if el, ok := c.items[e.short]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return 0
+	}
+
+	c.items[e.short] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		evicted++
+	}
+	return evicted
+}
+
+func (c *lru) remove(short string) {
+	if el, ok := c.items[short]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry).short)
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
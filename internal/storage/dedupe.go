@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// DedupeScope область уникальности полного адреса
+type DedupeScope string
+
+const (
+	DedupeGlobal DedupeScope = "global" // адрес сокращается один раз на весь сервис
+	DedupeUser   DedupeScope = "user"   // один раз для каждого пользователя
+	DedupeNone   DedupeScope = "none"   // каждое сокращение получает свою ссылку
+)
+
+// ParseDedupeScope область уникальности по названию
+func ParseDedupeScope(s string) (DedupeScope, error) {
+	switch scope := DedupeScope(s); scope {
+	case DedupeGlobal, DedupeUser, DedupeNone:
+		return scope, nil
+	}
+	return "", fmt.Errorf("unknown dedupe scope %q", s)
+}
+
+// OriginKey ключ уникальности адреса origin пользователя userID.
+// Без уникальности ключа нет. Пустая область равна DedupeGlobal.
+func (s DedupeScope) OriginKey(userID, origin string) (string, bool) {
+	switch s {
+	case DedupeUser:
+		return userID + "\x00" + origin, true
+	case DedupeNone:
+		return "", false
+	}
+	return origin, true
+}
+
+// Taken короткая ссылка сохранённой записи old занята для записи data.
+// Ссылку можно перезаписать только тем же адресом, а вне общей
+// уникальности ещё и тем же пользователем: чужая ссылка на тот же адрес
+// остаётся за своим владельцем.
+func (s DedupeScope) Taken(old, data model.StoreData) bool {
+	if old.OriginalURL != data.OriginalURL {
+		return true
+	}
+	return s != DedupeGlobal && s != "" && old.UserID != data.UserID
+}
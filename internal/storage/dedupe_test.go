@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+func TestParseDedupeScope(t *testing.T) {
+	for _, s := range []string{"global", "user", "none"} {
+		scope, err := ParseDedupeScope(s)
+		require.NoError(t, err)
+		assert.Equal(t, DedupeScope(s), scope)
+	}
+	_, err := ParseDedupeScope("users")
+	assert.Error(t, err)
+}
+
+func TestOriginKey(t *testing.T) {
+	tests := []struct {
+		scope DedupeScope
+		same  bool // ключи адреса разных пользователей совпадают
+		ok    bool
+	}{
+		{"", true, true},
+		{DedupeGlobal, true, true},
+		{DedupeUser, false, true},
+		{DedupeNone, false, false}, // ключа нет вовсе
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scope), func(t *testing.T) {
+			a, ok := tt.scope.OriginKey("a", "ya.ru")
+			assert.Equal(t, tt.ok, ok)
+			if !ok {
+				return
+			}
+			b, _ := tt.scope.OriginKey("b", "ya.ru")
+			assert.Equal(t, tt.same, a == b)
+		})
+	}
+}
+
+func TestTaken(t *testing.T) {
+	old := model.StoreData{UserID: "a", ShortURL: "s", OriginalURL: "ya.ru"}
+	other := model.StoreData{UserID: "b", ShortURL: "s", OriginalURL: "ya.ru"}
+	moved := model.StoreData{UserID: "a", ShortURL: "s", OriginalURL: "go.dev"}
+
+	for _, scope := range []DedupeScope{"", DedupeGlobal, DedupeUser, DedupeNone} {
+		assert.False(t, scope.Taken(old, old), scope)
+		assert.True(t, scope.Taken(old, moved), scope)
+	}
+	// владелец меняется только при общей уникальности
+	assert.False(t, DedupeGlobal.Taken(old, other))
+	assert.True(t, DedupeUser.Taken(old, other))
+	assert.True(t, DedupeNone.Taken(old, other))
+}
@@ -2,22 +2,77 @@ package memstore
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/eugene982/url-shortener/internal/logger"
 	"github.com/eugene982/url-shortener/internal/model"
 )
 
-// Временное хранилище адресов на диске
+// Тип записи журнала
+type recordOp string
+
+const (
+	opCreate  recordOp = "create"  // новая ссылка
+	opUpdate  recordOp = "update"  // добавление или замена ссылки
+	opDelete  recordOp = "delete"  // пометка ссылок на удаление
+	opPurge   recordOp = "purge"   // очистка данных удалённых ссылок
+	opRemove  recordOp = "remove"  // удаление ссылок вместе с короткой ссылкой
+	opRestore recordOp = "restore" // снятие пометки на удаление
+	opEnqueue recordOp = "enqueue" // постановка задачи удаления в очередь
+	opAck     recordOp = "ack"     // подтверждение выполненных задач удаления
+)
+
+// Запись журнала.
+// Строки старого формата без типа содержат только данные ссылки
+// и читаются как обновление.
+type journalRecord struct {
+	Op     recordOp         `json:"op"`
+	Data   *model.StoreData `json:"data,omitempty"`
+	Shorts []string         `json:"shorts,omitempty"`
+	Time   *time.Time       `json:"time,omitempty"` // время пометки на удаление
+	Job    *journalJob      `json:"job,omitempty"`  // задача удаления
+	Jobs   []string         `json:"jobs,omitempty"` // подтверждённые задачи удаления
+	CRC    *uint32          `json:"crc,omitempty"`  // контрольная сумма строки без этого поля
+}
+
+// Задача удаления в журнале
+type journalJob struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	ShortURLs []string  `json:"short_urls"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// поле контрольной суммы, всегда последнее в строке
+var crcField = []byte(`,"crc":`)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ошибка чтения повреждённой записи журнала
+var errCorruptRecord = errors.New("corrupt journal record")
+
+// Временное хранилище адресов на диске.
+// Журнал изменений, каждая строка - запись в формате JSON.
 type fileStorage struct {
+	name    string
 	file    *os.File
 	writer  *bufio.Writer // ожидается, что записывать будем чаще чем записывать.
-	counter int
+	sync    SyncMode      // режим сброса записей на диск
+	dirty   bool          // есть записи, не сброшенные на диск
+	counter int           // последний выданный идентификатор
+	records int           // записей в журнале после последнего снимка
 }
 
 // Создание нового файла хранилища
-func newFileSorage(fname string) (*fileStorage, error) {
+func newFileSorage(fname string, sync SyncMode) (*fileStorage, error) {
 	file, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
@@ -26,8 +81,10 @@ func newFileSorage(fname string) (*fileStorage, error) {
 	writter := bufio.NewWriter(file)
 
 	return &fileStorage{
+		name:   fname,
 		file:   file,
 		writer: writter,
+		sync:   sync,
 	}, nil
 }
 
@@ -36,49 +93,216 @@ func (fs *fileStorage) Close() error {
 	if fs == nil {
 		return nil
 	}
+	if err := fs.Sync(); err != nil {
+		fs.file.Close()
+		return err
+	}
 	return fs.file.Close()
 }
 
-// чтение всех ранее сохраненных данных
-func (fs *fileStorage) ReadAll() ([]model.StoreData, error) {
+// Sync сброс записанного на диск
+func (fs *fileStorage) Sync() error {
+	if fs == nil || !fs.dirty {
+		return nil
+	}
+	fs.dirty = false
+	return fs.file.Sync()
+}
+
+// Чтение всех записей журнала после последнего снимка.
+// Повреждённая последняя строка, например недописанная при сбое,
+// отрезается с предупреждением. Повреждение в середине журнала - ошибка.
+func (fs *fileStorage) ReadAll() ([]journalRecord, error) {
 	if fs == nil {
 		return nil, nil
 	}
 
-	res := make([]model.StoreData, 0, 8)
-	scanner := bufio.NewScanner(fs.file)
+	res := make([]journalRecord, 0, 8)
+	reader := bufio.NewReader(fs.file)
+
+	var (
+		offset     int64 // начало текущей строки
+		corrupt    int64 = -1
+		corruptErr error
+		newline    = true // журнал оканчивается переводом строки
+	)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			newline = line[len(line)-1] == '\n'
+
+			// за повреждённой записью есть ещё строки, это уже не хвост
+			if corrupt >= 0 {
+				return nil, fmt.Errorf("offset %d: %w", corrupt, corruptErr)
+			}
+
+			rec, derr := decodeRecord(bytes.TrimRight(line, "\r\n"))
+			if derr != nil {
+				corrupt, corruptErr = offset, derr
+			} else {
+				res = append(res, rec)
+			}
+			offset += int64(len(line))
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if corrupt >= 0 {
+		logger.Warn("truncate corrupt journal tail",
+			"file", fs.name,
+			"offset", corrupt,
+			"bytes", offset-corrupt,
+			"error", corruptErr)
 
-	var data model.StoreData
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
+		if err := fs.file.Truncate(corrupt); err != nil {
+			return nil, err
+		}
+		if err := fs.file.Sync(); err != nil {
 			return nil, err
 		}
-		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+	} else if !newline {
+		// последняя запись цела, но перевод строки не успел записаться
+		if _, err := fs.file.Write([]byte{'\n'}); err != nil {
 			return nil, err
 		}
-		res = append(res, data)
 	}
 
-	fs.counter = len(res)
+	fs.records = len(res)
 	return res, nil
 }
 
-// Добавление новых данных
-func (fs *fileStorage) Append(data []model.StoreData) error {
+// Добавление новых записей.
+// Данным без идентификатора присваивается порядковый номер.
+func (fs *fileStorage) Append(records ...journalRecord) error {
 	if fs == nil {
 		return nil
 	}
 
-	for _, d := range data {
-		fs.counter++
+	for _, rec := range records {
+		if rec.Data != nil {
+			fs.counter++
 
-		if d.ID == "" {
-			d.ID = strconv.Itoa(fs.counter)
+			if rec.Data.ID == "" {
+				rec.Data.ID = strconv.Itoa(fs.counter)
+			}
 		}
-		err := json.NewEncoder(fs.writer).Encode(&d)
+		line, err := encodeRecord(rec)
 		if err != nil {
 			return err
 		}
+		if _, err = fs.writer.Write(line); err != nil {
+			return err
+		}
+		fs.records++
+	}
+
+	if err := fs.writer.Flush(); err != nil {
+		return err
 	}
-	return fs.writer.Flush()
+	fs.dirty = true
+
+	if fs.sync == SyncAlways {
+		return fs.Sync()
+	}
+	return nil
+}
+
+// продолжаем нумерацию после наибольшего сохранённого идентификатора
+func (fs *fileStorage) restoreCounter(records []journalRecord) {
+	for _, rec := range records {
+		if rec.Data == nil {
+			continue
+		}
+		if id, err := strconv.Atoi(rec.Data.ID); err == nil && id > fs.counter {
+			fs.counter = id
+		}
+	}
+}
+
+// Строка журнала: запись в JSON с контрольной суммой последним полем
+func encodeRecord(rec journalRecord) ([]byte, error) {
+	rec.CRC = nil
+	body, err := json.Marshal(&rec)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := crc32.Checksum(body, crcTable)
+
+	line := make([]byte, 0, len(body)+len(crcField)+12)
+	line = append(line, body[:len(body)-1]...) // без закрывающей скобки
+	line = append(line, crcField...)
+	line = strconv.AppendUint(line, uint64(sum), 10)
+	line = append(line, '}', '\n')
+	return line, nil
+}
+
+// разбор строки журнала
+func decodeRecord(line []byte) (journalRecord, error) {
+	var rec journalRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return journalRecord{}, fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+
+	// строки без контрольной суммы записаны прежними версиями
+	if rec.CRC != nil {
+		pos := bytes.LastIndex(line, crcField)
+		if pos < 0 {
+			return journalRecord{}, fmt.Errorf("%w: checksum not found", errCorruptRecord)
+		}
+		body := append(line[:pos:pos], '}')
+		if crc32.Checksum(body, crcTable) != *rec.CRC {
+			return journalRecord{}, fmt.Errorf("%w: checksum mismatch", errCorruptRecord)
+		}
+		rec.CRC = nil
+	}
+
+	switch rec.Op {
+	case "":
+		// старый формат, строка целиком - данные ссылки
+		var data model.StoreData
+		if err := json.Unmarshal(line, &data); err != nil {
+			return journalRecord{}, err
+		}
+		return journalRecord{Op: opUpdate, Data: &data}, nil
+
+	case opCreate, opUpdate:
+		if rec.Data == nil {
+			return journalRecord{}, fmt.Errorf("%w: %q without data", errCorruptRecord, rec.Op)
+		}
+	case opEnqueue:
+		if rec.Job == nil {
+			return journalRecord{}, fmt.Errorf("%w: %q without job", errCorruptRecord, rec.Op)
+		}
+	case opDelete, opPurge, opRemove, opRestore, opAck:
+	default:
+		return journalRecord{}, fmt.Errorf("%w: unknown operation %q", errCorruptRecord, rec.Op)
+	}
+	return rec, nil
+}
+
+// записи журнала для списка ссылок, каждая со своей копией данных
+func dataRecords(op recordOp, list []model.StoreData) []journalRecord {
+	res := make([]journalRecord, len(list))
+	for i, d := range list {
+		d := d
+		res[i] = journalRecord{Op: op, Data: &d}
+	}
+	return res
+}
+
+// запись постановки задачи удаления в очередь
+func enqueueRecord(job model.DeleteJob) journalRecord {
+	return journalRecord{Op: opEnqueue, Job: &journalJob{
+		ID:        job.ID,
+		UserID:    job.UserID,
+		ShortURLs: job.ShortURLs,
+		CreatedAt: job.CreatedAt,
+	}}
 }
@@ -0,0 +1,417 @@
+// Тестирование журнала файлового хранилища
+
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    journalRecord
+		wantErr bool
+	}{
+		{
+			name: "legacy",
+			line: `{"original_url":"ya.ru", "short_url":"short1"}`,
+			want: journalRecord{
+				Op:   opUpdate,
+				Data: &model.StoreData{ShortURL: "short1", OriginalURL: "ya.ru"},
+			},
+		},
+		{
+			name: "create",
+			line: `{"op":"create","data":{"user_id":"u","short_url":"s","original_url":"ya.ru","is_deleted":true}}`,
+			want: journalRecord{
+				Op: opCreate,
+				Data: &model.StoreData{
+					UserID: "u", ShortURL: "s", OriginalURL: "ya.ru", DeletedFlag: true},
+			},
+		},
+		{
+			name: "delete",
+			line: `{"op":"delete","shorts":["s1","s2"]}`,
+			want: journalRecord{Op: opDelete, Shorts: []string{"s1", "s2"}},
+		},
+		{
+			name: "ack",
+			line: `{"op":"ack","jobs":["j1"]}`,
+			want: journalRecord{Op: opAck, Jobs: []string{"j1"}},
+		},
+		{
+			name:    "enqueue without job",
+			line:    `{"op":"enqueue"}`,
+			wantErr: true,
+		},
+		{
+			name:    "create without data",
+			line:    `{"op":"create"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown",
+			line:    `{"op":"drop"}`,
+			wantErr: true,
+		},
+		{
+			name:    "broken",
+			line:    `{"op":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := decodeRecord([]byte(tt.line))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rec)
+		})
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	err = store.Set(ctx, model.StoreData{
+		UserID:      "user1",
+		ShortURL:    "s1",
+		OriginalURL: "ya.ru"})
+	require.NoError(t, err)
+
+	expiresAt := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = store.Update(ctx, []model.StoreData{
+		{UserID: "user2", ShortURL: "s2", OriginalURL: "go.dev", ExpiresAt: &expiresAt},
+		{UserID: "user2", ShortURL: "s3", OriginalURL: "google.com"},
+	})
+	require.NoError(t, err)
+
+	// перезапись ссылки другим пользователем
+	err = store.Update(ctx, []model.StoreData{
+		{UserID: "user1", ShortURL: "s3", OriginalURL: "google.com"},
+	})
+	require.NoError(t, err)
+
+	err = store.DeleteShort(ctx, []string{"s2", "none"})
+	require.NoError(t, err)
+
+	wantUser1, err := store.GetUserURLs(ctx, "user1")
+	require.NoError(t, err)
+	wantUser2, err := store.GetUserURLs(ctx, "user2")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// после перезапуска состояние восстанавливается полностью
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetUserURLs(ctx, "user1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, wantUser1, got)
+
+	got, err = store.GetUserURLs(ctx, "user2")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, wantUser2, got)
+
+	data, err := store.GetAddr(ctx, "s2")
+	require.NoError(t, err)
+	assert.True(t, data.DeletedFlag)
+	assert.Equal(t, "user2", data.UserID)
+	require.NotNil(t, data.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*data.ExpiresAt))
+
+	// полный адрес по-прежнему занят
+	err = store.Set(ctx, model.StoreData{ShortURL: "s4", OriginalURL: "ya.ru"})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+}
+
+func TestPurgeReplay(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+	}))
+	require.NoError(t, store.DeleteShort(ctx, []string{"s1", "s2"}))
+
+	before := time.Now().Add(time.Hour)
+	purged, err := store.PurgeDeleted(ctx, before, 1, false)
+	require.NoError(t, err)
+	require.Len(t, purged, 1)
+	kept := purged[0]
+
+	purged, err = store.PurgeDeleted(ctx, before, 0, true)
+	require.NoError(t, err)
+	require.Len(t, purged, 2)
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "user", ShortURL: kept, OriginalURL: "bing.com"}))
+	require.NoError(t, store.DeleteShort(ctx, []string{kept}))
+	_, err = store.PurgeDeleted(ctx, before, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// очистка и удаление восстанавливаются из журнала
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	data, err := store.GetAddr(ctx, kept)
+	require.NoError(t, err)
+	assert.True(t, data.Purged())
+	require.NotNil(t, data.DeletedAt)
+
+	list, err := store.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "user", ShortURL: "s3", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "user", ShortURL: "s4", OriginalURL: "bing.com"}))
+}
+
+func TestDeleteQueueReplay(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"j1", "j2", "j3"} {
+		require.NoError(t, store.EnqueueDelete(ctx, model.DeleteJob{
+			ID:        id,
+			UserID:    "user",
+			ShortURLs: []string{"s" + id},
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	require.NoError(t, store.AckDeletes(ctx, []string{"j1"}))
+
+	// невыполненные задачи переходят в снимок
+	require.NoError(t, store.Compact())
+	require.NoError(t, store.AckDeletes(ctx, []string{"j3"}))
+	require.NoError(t, store.Close())
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	list, err := store.PendingDeletes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "j2", list[0].ID)
+	assert.Equal(t, "user", list[0].UserID)
+	assert.Equal(t, []string{"sj2"}, list[0].ShortURLs)
+	assert.Equal(t, created.Add(time.Second), list[0].CreatedAt)
+}
+
+func TestDeleteQueueLargeJob(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	// запись задачи в снимке длиннее буфера bufio.Scanner
+	shorts := make([]string, 10000)
+	for i := range shorts {
+		shorts[i] = fmt.Sprintf("short%05d", i)
+	}
+	require.NoError(t, store.EnqueueDelete(ctx, model.DeleteJob{
+		ID:        "j1",
+		UserID:    "user",
+		ShortURLs: shorts,
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}))
+	require.NoError(t, store.Compact())
+	require.NoError(t, store.Close())
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	list, err := store.PendingDeletes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, shorts, list[0].ShortURLs)
+}
+
+func TestRecordChecksum(t *testing.T) {
+	rec := journalRecord{
+		Op:   opCreate,
+		Data: &model.StoreData{UserID: "u", ShortURL: "s", OriginalURL: `ya.ru/?q=,"crc":1}`},
+	}
+
+	line, err := encodeRecord(rec)
+	require.NoError(t, err)
+	require.True(t, bytes.HasSuffix(line, []byte("}\n")))
+
+	got, err := decodeRecord(bytes.TrimSpace(line))
+	require.NoError(t, err)
+	assert.Equal(t, rec, got)
+
+	// изменённые данные не проходят проверку
+	tampered := bytes.Replace(line, []byte(`"u"`), []byte(`"x"`), 1)
+	_, err = decodeRecord(bytes.TrimSpace(tampered))
+	require.ErrorIs(t, err, errCorruptRecord)
+}
+
+func TestTornTail(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+	err = store.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	valid, err := os.ReadFile(fname)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"torn json", `{"op":"create","data":{"user_id":"us`},
+		{"zero fill", "\x00\x00\x00\x00\x00\x00"},
+		{"bad checksum", `{"op":"delete","shorts":["s1"],"crc":1}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(fname, append(valid[:len(valid):len(valid)], tt.tail...), 0666))
+
+			store, err := New(fname)
+			require.NoError(t, err)
+
+			urls, _, err := store.Stats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 2, urls)
+
+			// запись продолжается с целой строки
+			require.NoError(t, store.DeleteShort(ctx, []string{"s1"}))
+			require.NoError(t, store.Close())
+
+			store, err = New(fname)
+			require.NoError(t, err)
+			defer store.Close()
+
+			data, err := store.GetAddr(ctx, "s1")
+			require.NoError(t, err)
+			assert.True(t, data.DeletedFlag)
+		})
+	}
+}
+
+func TestMissingLastNewline(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	line, err := encodeRecord(journalRecord{
+		Op:   opCreate,
+		Data: &model.StoreData{ShortURL: "s1", OriginalURL: "ya.ru"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fname, bytes.TrimSpace(line), 0666))
+
+	store, err := New(fname)
+	require.NoError(t, err)
+	err = store.Set(ctx, model.StoreData{ShortURL: "s2", OriginalURL: "go.dev"})
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	urls, _, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, urls)
+}
+
+func TestCorruptMiddle(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+
+	first, err := encodeRecord(journalRecord{
+		Op:   opCreate,
+		Data: &model.StoreData{ShortURL: "s1", OriginalURL: "ya.ru"},
+	})
+	require.NoError(t, err)
+	last, err := encodeRecord(journalRecord{Op: opDelete, Shorts: []string{"s1"}})
+	require.NoError(t, err)
+
+	content := append(bytes.Replace(first, []byte("ya.ru"), []byte("ya.de"), 1), last...)
+	require.NoError(t, os.WriteFile(fname, content, 0666))
+
+	_, err = New(fname)
+	require.ErrorIs(t, err, errCorruptRecord)
+
+	// журнал не тронут
+	got, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func TestSyncModes(t *testing.T) {
+	ctx := context.Background()
+
+	for _, mode := range []SyncMode{SyncAlways, SyncInterval, SyncNone} {
+		t.Run(string(mode), func(t *testing.T) {
+			parsed, err := ParseSyncMode(string(mode))
+			require.NoError(t, err)
+			require.Equal(t, mode, parsed)
+
+			fname := filepath.Join(t.TempDir(), "short-url-db.json")
+			store, err := New(fname, WithSync(mode, 10*time.Millisecond))
+			require.NoError(t, err)
+			defer store.Close()
+
+			err = store.Set(ctx, model.StoreData{ShortURL: "s1", OriginalURL: "ya.ru"})
+			require.NoError(t, err)
+
+			switch mode {
+			case SyncAlways:
+				assert.False(t, store.fs.dirty)
+			case SyncInterval:
+				assert.Eventually(t, func() bool {
+					store.mx.Lock()
+					defer store.mx.Unlock()
+					return !store.fs.dirty
+				}, time.Second, 10*time.Millisecond)
+			case SyncNone:
+				assert.True(t, store.fs.dirty)
+			}
+		})
+	}
+
+	_, err := ParseSyncMode("sometimes")
+	require.Error(t, err)
+}
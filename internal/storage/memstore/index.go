@@ -0,0 +1,380 @@
+package memstore
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// количество сегментов индекса, степень двойки
+const shardCount = 32
+
+// Сегмент индекса со своей блокировкой
+type shard[V any] struct {
+	mx sync.RWMutex
+	m  map[string]V
+}
+
+// Карта, разбитая на сегменты по хешу ключа.
+// Конкурирующие запросы к разным ключам почти не блокируют друг друга.
+type shardedMap[V any] struct {
+	shards [shardCount]shard[V]
+}
+
+func newShardedMap[V any]() *shardedMap[V] {
+	sm := &shardedMap[V]{}
+	for i := range sm.shards {
+		sm.shards[i].m = make(map[string]V)
+	}
+	return sm
+}
+
+// сегмент по ключу, хеш FNV-1a без лишних аллокаций
+func (sm *shardedMap[V]) shard(key string) *shard[V] {
+	var h uint32 = 2166136261
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &sm.shards[h&(shardCount-1)]
+}
+
+// Индекс ссылок в памяти.
+// Основные данные лежат в сегментах по короткой ссылке,
+// вторичные индексы по пользователю и адресу позволяют не перебирать все ссылки.
+// Чтение безопасно из любого количества горутин и берёт только блокировку сегмента,
+// изменения должны выполняться под блокировкой записи хранилища.
+type index struct {
+	byShort  *shardedMap[model.StoreData]
+	byUser   *shardedMap[map[string]struct{}] // пользователь -> набор коротких ссылок
+	byOrigin *shardedMap[string]              // ключ уникальности адреса -> короткая ссылка
+	live     map[string]int                   // пользователь -> неудалённых ссылок, только под записью
+	jobs     map[string]model.DeleteJob       // невыполненные задачи удаления, только под записью
+	urls     atomic.Int64                     // неудалённых ссылок
+	users    atomic.Int64                     // пользователей с неудалёнными ссылками
+	scope    storage.DedupeScope              // область уникальности адреса
+}
+
+func newIndex(scope storage.DedupeScope) *index {
+	return &index{
+		scope:    scope,
+		byShort:  newShardedMap[model.StoreData](),
+		byUser:   newShardedMap[map[string]struct{}](),
+		byOrigin: newShardedMap[string](),
+		live:     make(map[string]int),
+		jobs:     make(map[string]model.DeleteJob),
+	}
+}
+
+// получение данных по короткой ссылке
+func (idx *index) get(short string) (model.StoreData, bool) {
+	sh := idx.byShort.shard(short)
+	sh.mx.RLock()
+	defer sh.mx.RUnlock()
+
+	data, ok := sh.m[short]
+	return data, ok
+}
+
+// проверка наличия сохранённого полного адреса в области уникальности
+func (idx *index) hasOrigin(userID, addr string) bool {
+	_, ok := idx.originShort(userID, addr)
+	return ok
+}
+
+// короткая ссылка, которой занят адрес в области уникальности
+func (idx *index) originShort(userID, addr string) (string, bool) {
+	key, ok := idx.scope.OriginKey(userID, addr)
+	if !ok {
+		return "", false
+	}
+	sh := idx.byOrigin.shard(key)
+	sh.mx.RLock()
+	defer sh.mx.RUnlock()
+
+	short, ok := sh.m[key]
+	return short, ok
+}
+
+// снятие адреса с короткой ссылки short
+func (idx *index) unlinkOrigin(data model.StoreData, short string) {
+	key, ok := idx.scope.OriginKey(data.UserID, data.OriginalURL)
+	if !ok {
+		return
+	}
+	sh := idx.byOrigin.shard(key)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	if sh.m[key] == short {
+		delete(sh.m, key)
+	}
+}
+
+// добавление или замена данных по короткой ссылке
+func (idx *index) put(data model.StoreData) {
+	sh := idx.byShort.shard(data.ShortURL)
+	sh.mx.Lock()
+	old, exists := sh.m[data.ShortURL]
+	sh.m[data.ShortURL] = data
+	sh.mx.Unlock()
+
+	if exists {
+		idx.unlinkOrigin(old, old.ShortURL)
+		if old.UserID != data.UserID || data.Purged() {
+			idx.unlinkUser(old.UserID, old.ShortURL)
+		}
+		idx.count(old, -1)
+	}
+	idx.count(data, 1)
+
+	// очищенная ссылка остаётся только в основном индексе
+	if data.Purged() {
+		return
+	}
+	if key, ok := idx.scope.OriginKey(data.UserID, data.OriginalURL); ok {
+		sh := idx.byOrigin.shard(key)
+		sh.mx.Lock()
+		sh.m[key] = data.ShortURL
+		sh.mx.Unlock()
+	}
+	idx.linkUser(data.UserID, data.ShortURL)
+}
+
+// удаление ссылки из всех индексов
+func (idx *index) remove(short string) {
+	sh := idx.byShort.shard(short)
+	sh.mx.Lock()
+	data, ok := sh.m[short]
+	delete(sh.m, short)
+	sh.mx.Unlock()
+
+	if !ok {
+		return
+	}
+	idx.unlinkOrigin(data, short)
+	idx.unlinkUser(data.UserID, short)
+	idx.count(data, -1)
+}
+
+// изменение данных по короткой ссылке, если она есть
+func (idx *index) modify(short string, fn func(*model.StoreData)) bool {
+	sh := idx.byShort.shard(short)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	data, ok := sh.m[short]
+	if ok {
+		idx.count(data, -1)
+		fn(&data)
+		sh.m[short] = data
+		idx.count(data, 1)
+	}
+	return ok
+}
+
+// учёт неудалённой ссылки в статистике
+func (idx *index) count(data model.StoreData, delta int) {
+	if data.DeletedFlag {
+		return
+	}
+	idx.urls.Add(int64(delta))
+
+	n := idx.live[data.UserID]
+	switch {
+	case n == 0 && delta > 0:
+		idx.users.Add(1)
+	case n+delta == 0:
+		idx.users.Add(-1)
+	}
+	if n += delta; n == 0 {
+		delete(idx.live, data.UserID)
+	} else {
+		idx.live[data.UserID] = n
+	}
+}
+
+// применение записи журнала к индексу
+func (idx *index) apply(rec journalRecord) {
+	switch rec.Op {
+	case opCreate, opUpdate:
+		idx.put(*rec.Data)
+	case opDelete:
+		// у записей прежних версий нет времени, удалёнными они считаются с загрузки
+		at := time.Now().UTC()
+		if rec.Time != nil {
+			at = *rec.Time
+		}
+		for _, short := range rec.Shorts {
+			idx.modify(short, func(data *model.StoreData) {
+				if !data.DeletedFlag {
+					data.DeletedFlag = true
+					data.DeletedAt = &at
+				}
+			})
+		}
+	case opPurge:
+		for _, short := range rec.Shorts {
+			if data, ok := idx.get(short); ok && data.DeletedFlag {
+				idx.put(model.StoreData{
+					ID:          data.ID,
+					ShortURL:    short,
+					DeletedFlag: true,
+					DeletedAt:   data.DeletedAt,
+				})
+			}
+		}
+	case opRemove:
+		for _, short := range rec.Shorts {
+			idx.remove(short)
+		}
+	case opRestore:
+		for _, short := range rec.Shorts {
+			idx.modify(short, func(data *model.StoreData) {
+				data.DeletedFlag = false
+				data.DeletedAt = nil
+			})
+		}
+	case opEnqueue:
+		idx.jobs[rec.Job.ID] = model.DeleteJob{
+			ID:        rec.Job.ID,
+			UserID:    rec.Job.UserID,
+			ShortURLs: rec.Job.ShortURLs,
+			Status:    model.DeleteJobPending,
+			CreatedAt: rec.Job.CreatedAt,
+		}
+	case opAck:
+		for _, id := range rec.Jobs {
+			delete(idx.jobs, id)
+		}
+	}
+}
+
+// все ссылки пользователя
+func (idx *index) userURLs(userID string) []model.StoreData {
+	sh := idx.byUser.shard(userID)
+	sh.mx.RLock()
+	shorts := make([]string, 0, len(sh.m[userID]))
+	for short := range sh.m[userID] {
+		shorts = append(shorts, short)
+	}
+	sh.mx.RUnlock()
+
+	res := make([]model.StoreData, 0, len(shorts))
+	for _, short := range shorts {
+		if data, ok := idx.get(short); ok {
+			res = append(res, data)
+		}
+	}
+	return res
+}
+
+// копия всех ссылок
+func (idx *index) all() []model.StoreData {
+	res := make([]model.StoreData, 0, idx.urls.Load())
+	for i := range idx.byShort.shards {
+		sh := &idx.byShort.shards[i]
+		sh.mx.RLock()
+		for _, data := range sh.m {
+			res = append(res, data)
+		}
+		sh.mx.RUnlock()
+	}
+	return res
+}
+
+// неудалённые ссылки с истёкшим к now сроком, не больше limit при limit > 0
+func (idx *index) expired(now time.Time, limit int) []string {
+	var res []string
+	for i := range idx.byShort.shards {
+		sh := &idx.byShort.shards[i]
+		sh.mx.RLock()
+		for short, data := range sh.m {
+			if !data.DeletedFlag && data.Expired(now) {
+				res = append(res, short)
+			}
+		}
+		sh.mx.RUnlock()
+
+		if limit > 0 && len(res) >= limit {
+			return res[:limit]
+		}
+	}
+	return res
+}
+
+// Ссылки, помеченные на удаление не позже before, не больше limit при limit > 0.
+// Без free уже очищенные пропускаются.
+func (idx *index) deleted(before time.Time, limit int, free bool) []string {
+	var res []string
+	for i := range idx.byShort.shards {
+		sh := &idx.byShort.shards[i]
+		sh.mx.RLock()
+		for short, data := range sh.m {
+			if !data.DeletedFlag || data.DeletedAt == nil || data.DeletedAt.After(before) {
+				continue
+			}
+			if free || !data.Purged() {
+				res = append(res, short)
+			}
+		}
+		sh.mx.RUnlock()
+
+		if limit > 0 && len(res) >= limit {
+			return res[:limit]
+		}
+	}
+	return res
+}
+
+// количество неудалённых ссылок и их пользователей
+func (idx *index) stats() (urls int, users int) {
+	return int(idx.urls.Load()), int(idx.users.Load())
+}
+
+func (idx *index) linkUser(userID, short string) {
+	sh := idx.byUser.shard(userID)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	set, ok := sh.m[userID]
+	if !ok {
+		set = make(map[string]struct{})
+		sh.m[userID] = set
+	}
+	set[short] = struct{}{}
+}
+
+func (idx *index) unlinkUser(userID, short string) {
+	sh := idx.byUser.shard(userID)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	set, ok := sh.m[userID]
+	if !ok {
+		return
+	}
+	delete(set, short)
+	if len(set) == 0 {
+		delete(sh.m, userID)
+	}
+}
+
+// невыполненные задачи удаления в порядке постановки, вызывается под блокировкой записи
+func (idx *index) pendingJobs() []model.DeleteJob {
+	res := make([]model.DeleteJob, 0, len(idx.jobs))
+	for _, job := range idx.jobs {
+		res = append(res, job)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
@@ -0,0 +1,207 @@
+// Тестирование индекса и конкурентного доступа к хранилищу
+
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+func TestIndex(t *testing.T) {
+	idx := newIndex(storage.DedupeGlobal)
+
+	idx.put(model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"})
+	idx.put(model.StoreData{UserID: "u1", ShortURL: "s2", OriginalURL: "a2"})
+	idx.put(model.StoreData{UserID: "u2", ShortURL: "s3", OriginalURL: "a3"})
+
+	urls, users := idx.stats()
+	assert.Equal(t, 3, urls)
+	assert.Equal(t, 2, users)
+	assert.Len(t, idx.userURLs("u1"), 2)
+	assert.True(t, idx.hasOrigin("u2", "a1"))
+
+	// перезапись ссылки другим пользователем и адресом
+	idx.put(model.StoreData{UserID: "u2", ShortURL: "s1", OriginalURL: "b1"})
+
+	urls, users = idx.stats()
+	assert.Equal(t, 3, urls)
+	assert.Equal(t, 2, users)
+	assert.Len(t, idx.userURLs("u1"), 1)
+	assert.Len(t, idx.userURLs("u2"), 2)
+	assert.False(t, idx.hasOrigin("u2", "a1"))
+	assert.True(t, idx.hasOrigin("u2", "b1"))
+
+	// последняя ссылка пользователя переходит другому
+	idx.put(model.StoreData{UserID: "u2", ShortURL: "s2", OriginalURL: "a2"})
+	_, users = idx.stats()
+	assert.Equal(t, 1, users)
+	assert.Empty(t, idx.userURLs("u1"))
+
+	ok := idx.modify("s3", func(d *model.StoreData) { d.DeletedFlag = true })
+	assert.True(t, ok)
+	data, ok := idx.get("s3")
+	require.True(t, ok)
+	assert.True(t, data.DeletedFlag)
+
+	// удалённые ссылки не попадают в статистику
+	urls, users = idx.stats()
+	assert.Equal(t, 2, urls)
+	assert.Equal(t, 1, users)
+
+	ok = idx.modify("-", func(d *model.StoreData) { d.DeletedFlag = true })
+	assert.False(t, ok)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	const (
+		workers = 16
+		perUser = 200
+	)
+
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			userID := fmt.Sprintf("user%d", w)
+			for i := 0; i < perUser; i++ {
+				data := model.StoreData{
+					UserID:      userID,
+					ShortURL:    fmt.Sprintf("s%d-%d", w, i),
+					OriginalURL: fmt.Sprintf("http://%d.ru/%d", w, i),
+				}
+
+				if i%2 == 0 {
+					assert.NoError(t, store.Set(ctx, data))
+				} else {
+					assert.NoError(t, store.Update(ctx, []model.StoreData{data}))
+				}
+
+				// все горутины конкурируют за один и тот же адрес
+				err := store.Set(ctx, model.StoreData{
+					UserID:      userID,
+					ShortURL:    "shared",
+					OriginalURL: "http://shared.ru",
+				})
+				if err != nil && !errors.Is(err, storage.ErrAddressConflict) {
+					t.Error(err)
+				}
+
+				_, err = store.GetAddr(ctx, data.ShortURL)
+				assert.NoError(t, err)
+
+				_, err = store.GetUserURLs(ctx, fmt.Sprintf("user%d", (w+1)%workers))
+				assert.NoError(t, err)
+
+				if i%10 == 0 {
+					assert.NoError(t, store.DeleteShort(ctx, []string{data.ShortURL}))
+				}
+
+				_, _, err = store.Stats(ctx)
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// удалённые ссылки в статистику не входят
+	live := workers*(perUser-perUser/10) + 1
+
+	urls, users, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, live, urls)
+	assert.Equal(t, workers, users)
+
+	for w := 0; w < workers; w++ {
+		list, err := store.GetUserURLs(ctx, fmt.Sprintf("user%d", w))
+		require.NoError(t, err)
+
+		deleted := 0
+		for _, d := range list {
+			if d.DeletedFlag {
+				deleted++
+			}
+		}
+		assert.Equal(t, perUser/10, deleted)
+	}
+	require.NoError(t, store.Close())
+
+	// всё записанное конкурентно читается из файла
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	urls, _, err = store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, live, urls)
+}
+
+func TestConcurrentReadWrite(t *testing.T) {
+	store, err := New("")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	done := make(chan struct{})
+
+	// писатель постоянно перезаписывает одну и ту же ссылку
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			err := store.Update(ctx, []model.StoreData{{
+				UserID:      fmt.Sprintf("user%d", i%3),
+				ShortURL:    "short",
+				OriginalURL: "http://ya.ru",
+			}})
+			assert.NoError(t, err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := store.GetAddr(ctx, "short"); err != nil {
+					assert.ErrorIs(t, err, storage.ErrAddressNotFound)
+				}
+				_, err := store.GetUserURLs(ctx, "user1")
+				assert.NoError(t, err)
+				// поиск по адресу идёт без общей блокировки записи
+				if data, err := store.GetByOrigin(ctx, "user1", "http://ya.ru"); err == nil {
+					assert.Equal(t, "short", data.ShortURL)
+				} else {
+					assert.ErrorIs(t, err, storage.ErrAddressNotFound)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	urls, users, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, urls)
+	assert.Equal(t, 1, users)
+}
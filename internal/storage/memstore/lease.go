@@ -0,0 +1,98 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// расширение файла с границей выданных номеров рядом с журналом
+const leaseExt = ".ids"
+
+// Утверждение типа, ошибка компиляции
+var _ storage.IDLeaser = (*MemStore)(nil)
+
+// выдача блоков номеров счётчика коротких ссылок
+type idLease struct {
+	mx    sync.Mutex
+	fname string // файл границы, пусто - только в памяти
+	next  uint64 // первый невыданный номер
+}
+
+// чтение границы выданных номеров, отсутствие файла не ошибка
+func (l *idLease) load(fname string) error {
+	l.fname = fname + leaseExt
+
+	b, err := os.ReadFile(l.fname)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	l.next, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("error read id lease: %w", err)
+	}
+	return nil
+}
+
+// LeaseIDs блок из n номеров.
+// Граница записывается атомарно до выдачи блока, поэтому после
+// перезапуска или сбоя выданные номера не повторяются.
+func (m *MemStore) LeaseIDs(ctx context.Context, n uint64) (uint64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+
+	l := &m.lease
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	start := l.next
+	if n == 0 || start+n < start {
+		return 0, errors.New("wrong id block size")
+	}
+	if l.fname != "" {
+		if err := writeLease(l.fname, start+n); err != nil {
+			return 0, fmt.Errorf("error write id lease: %w", err)
+		}
+	}
+	l.next = start + n
+	return start, nil
+}
+
+// атомарная запись границы: во временный файл, fsync, переименование
+func writeLease(fname string, next uint64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// при ошибке временный файл не нужен
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strconv.FormatUint(next, 10) + "\n")
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), fname); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(fname))
+}
@@ -0,0 +1,52 @@
+// Тестирование выдачи блоков номеров
+
+package memstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseRestart(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	start, err := store.LeaseIDs(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), start)
+	// сбой без закрытия: граница уже на диске
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	start, err = store.LeaseIDs(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), start)
+	require.NoError(t, store.Close())
+
+	b, err := os.ReadFile(fname + leaseExt)
+	require.NoError(t, err)
+	assert.Equal(t, "110\n", string(b))
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+	start, err = store.LeaseIDs(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(110), start)
+}
+
+func TestLeaseReadError(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	require.NoError(t, os.WriteFile(fname+leaseExt, []byte("bad"), 0600))
+
+	_, err := New(fname)
+	assert.Error(t, err)
+}
@@ -1,72 +1,232 @@
 // Хранилище раннее сгенерированных ссылок.
-// построен на мапе.
+// построен на сегментированном индексе в памяти.
+// Чтения берут только блокировки сегментов и масштабируются по ядрам.
+// Изменения идут под общей блокировкой: проверки уникальности затрагивают
+// несколько сегментов, а порядок записей в журнале должен совпадать
+// с порядком изменений индекса.
 // Удовлетворяет интерфейсу "Storage"
 package memstore
 
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/eugene982/url-shortener/internal/logger"
 	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/eugene982/url-shortener/internal/storage"
 )
 
 // Объявление структуры-хранителя
 type MemStore struct {
-	addrList   map[string]model.StoreData
-	savingAddr map[string]bool
-	fs         *fileStorage // запись во временный файл
+	mx  sync.Mutex   // сериализует изменения индекса и запись в файл
+	idx *index       // ссылки в памяти
+	fs  *fileStorage // запись во временный файл
+
+	lease idLease // выдача блоков номеров счётчика
+
+	compactRecords  int                 // порог записей журнала для снимка
+	compactInterval time.Duration       // период проверки порога
+	syncMode        SyncMode            // режим сброса журнала на диск
+	syncInterval    time.Duration       // период общего сброса
+	dedupe          storage.DedupeScope // область уникальности адреса
+	stop            chan struct{}
+	wg              sync.WaitGroup
 }
 
 // Утверждение типа, ошибка компиляции
-var _ storage.Storage = (*MemStore)(nil)
+var (
+	_ storage.Storage      = (*MemStore)(nil)
+	_ storage.OriginGetter = (*MemStore)(nil)
+)
+
+// Option настройка хранилища
+type Option func(*MemStore)
+
+// WithCompaction фоновое сжатие журнала в снимок,
+// когда в нём накопилось не меньше records записей.
+// Порог проверяется с периодом interval.
+func WithCompaction(records int, interval time.Duration) Option {
+	return func(m *MemStore) {
+		m.compactRecords = records
+		m.compactInterval = interval
+	}
+}
+
+// SyncMode режим сброса журнала на диск
+type SyncMode string
+
+const (
+	SyncAlways   SyncMode = "always"   // fsync после каждой записи
+	SyncInterval SyncMode = "interval" // общий fsync накопленных записей с периодом
+	SyncNone     SyncMode = "none"     // сброс на диск остаётся операционной системе
+)
+
+// ParseSyncMode режим сброса по названию
+func ParseSyncMode(s string) (SyncMode, error) {
+	switch mode := SyncMode(s); mode {
+	case SyncAlways, SyncInterval, SyncNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown file sync mode %q", s)
+}
+
+// WithSync режим сброса журнала на диск.
+// Для SyncInterval записи сбрасываются общим fsync с периодом interval.
+func WithSync(mode SyncMode, interval time.Duration) Option {
+	return func(m *MemStore) {
+		m.syncMode = mode
+		m.syncInterval = interval
+	}
+}
+
+// WithDedupe область уникальности полного адреса, по умолчанию storage.DedupeGlobal.
+// Индекс адресов строится при чтении журнала, поэтому область можно менять между запусками.
+func WithDedupe(scope storage.DedupeScope) Option {
+	return func(m *MemStore) {
+		m.dedupe = scope
+	}
+}
 
 // Функция-конструктор нового хранилща
-func New(fname string) (*MemStore, error) {
+func New(fname string, opts ...Option) (*MemStore, error) {
 
-	var (
-		err        error
-		fs         *fileStorage
-		addrList   = make(map[string]model.StoreData)
-		savingAddr = make(map[string]bool)
-	)
+	ms := &MemStore{
+		syncMode: SyncNone,
+		dedupe:   storage.DedupeGlobal,
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ms)
+	}
+	ms.idx = newIndex(ms.dedupe)
 
 	// хранение ранее созданных сокращений в файле
 	// для восстановления после перезапуска.
 	if fname != "" {
-		if fs, err = newFileSorage(fname); err != nil {
-			return nil, fmt.Errorf("error open file storage: %w", err)
-		}
-
-		urls, err := fs.ReadAll()
-		if err != nil {
-			return nil, fmt.Errorf("error read from file storage: %w", err)
-		}
-		// переносим все ранее сохранённые значения из файла
-		for _, v := range urls {
-			addrList[v.ShortURL] = model.StoreData{
-				ShortURL:    v.ShortURL,
-				OriginalURL: v.OriginalURL,
-			}
-			savingAddr[v.OriginalURL] = true
+		if err := ms.load(fname); err != nil {
+			return nil, err
 		}
 	}
 
-	ms := &MemStore{
-		addrList:   addrList,
-		savingAddr: savingAddr,
-		fs:         fs,
+	if ms.fs != nil && ms.compactRecords > 0 && ms.compactInterval > 0 {
+		ms.wg.Add(1)
+		go ms.startCompaction()
+	}
+	if ms.fs != nil && ms.syncMode == SyncInterval && ms.syncInterval > 0 {
+		ms.wg.Add(1)
+		go ms.startSync()
 	}
 	return ms, nil
 }
 
+// восстановление состояния из снимка и хвоста журнала
+func (m *MemStore) load(fname string) error {
+	if err := m.lease.load(fname); err != nil {
+		return err
+	}
+
+	snapshot, err := readSnapshot(fname)
+	if err != nil {
+		return fmt.Errorf("error read snapshot: %w", err)
+	}
+
+	fs, err := newFileSorage(fname, m.syncMode)
+	if err != nil {
+		return fmt.Errorf("error open file storage: %w", err)
+	}
+
+	records, err := fs.ReadAll()
+	if err != nil {
+		fs.Close()
+		return fmt.Errorf("error read from file storage: %w", err)
+	}
+
+	// восстанавливаем состояние, проигрывая снимок и журнал
+	for _, list := range [][]journalRecord{snapshot, records} {
+		fs.restoreCounter(list)
+		for _, rec := range list {
+			m.idx.apply(rec)
+		}
+	}
+
+	m.fs = fs
+	return nil
+}
+
 func (m *MemStore) Close() error {
+	close(m.stop)
+	m.wg.Wait()
+
 	if err := m.fs.Close(); err != nil {
 		return fmt.Errorf("error close file storage: %w", err)
 	}
 	return nil
 }
 
+// Compact запись снимка всех ссылок и очистка журнала
+func (m *MemStore) Compact() error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if err := m.fs.Snapshot(m.idx.all(), m.idx.pendingJobs()); err != nil {
+		return fmt.Errorf("error compact file storage: %w", err)
+	}
+	return nil
+}
+
+// Периодический общий сброс журнала на диск
+func (m *MemStore) startSync() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.mx.Lock()
+			err := m.fs.Sync()
+			m.mx.Unlock()
+
+			if err != nil {
+				logger.Error(fmt.Errorf("error sync file storage: %w", err))
+			}
+		}
+	}
+}
+
+// Периодическая проверка размера журнала
+func (m *MemStore) startCompaction() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.mx.Lock()
+			records := m.fs.records
+			m.mx.Unlock()
+
+			if records < m.compactRecords {
+				continue
+			}
+			if err := m.Compact(); err != nil {
+				logger.Error(err)
+				continue
+			}
+			logger.Info("file storage compacted", "records", records)
+		}
+	}
+}
+
 // Проверка соединения до хранилища
 func (m *MemStore) Ping(ctx context.Context) (err error) {
 	select {
@@ -85,12 +245,29 @@ func (m *MemStore) GetAddr(ctx context.Context, short string) (data model.StoreD
 	default:
 	}
 
-	if data, ok := m.addrList[short]; ok {
+	if data, ok := m.idx.get(short); ok {
 		return data, nil
 	}
 	return model.StoreData{}, storage.ErrAddressNotFound
 }
 
+// Получение ссылки по полному адресу
+func (m *MemStore) GetByOrigin(ctx context.Context, userID, origin string) (data model.StoreData, err error) {
+	select {
+	case <-ctx.Done():
+		return model.StoreData{}, ctx.Err()
+	default:
+	}
+
+	// между чтениями индексов ссылку могли перезаписать другим адресом
+	if short, ok := m.idx.originShort(userID, origin); ok {
+		if data, ok := m.idx.get(short); ok && data.OriginalURL == origin {
+			return data, nil
+		}
+	}
+	return model.StoreData{}, storage.ErrAddressNotFound
+}
+
 // Установка уникального соответствия
 func (m *MemStore) Set(ctx context.Context, data model.StoreData) error {
 	select {
@@ -99,20 +276,22 @@ func (m *MemStore) Set(ctx context.Context, data model.StoreData) error {
 	default:
 	}
 
-	// Проверка на налицие сохранённого полного адреса
-	if m.savingAddr[data.OriginalURL] {
-		return storage.ErrAddressConflict
-	}
-
 	if ok, err := data.IsValid(); !ok {
 		return err
 	}
 
-	list := []model.StoreData{
-		data,
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	// Проверка на налицие сохранённого полного адреса и короткой ссылки
+	if m.idx.hasOrigin(data.UserID, data.OriginalURL) {
+		return storage.ErrAddressConflict
+	}
+	if _, ok := m.idx.get(data.ShortURL); ok {
+		return storage.ErrShortConflict
 	}
 
-	return m.Update(ctx, list)
+	return m.write(journalRecord{Op: opCreate, Data: &data})
 }
 
 // Установка/обновление соответствиq между адресом и короткой ссылкой
@@ -123,13 +302,44 @@ func (m *MemStore) Update(ctx context.Context, list []model.StoreData) error {
 	default:
 	}
 
-	if err := m.fs.Append(list); err != nil {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	// полный адрес не должен быть занят другой короткой ссылкой,
+	// а короткая ссылка - другим адресом или владельцем,
+	// ни в хранилище, ни в предыдущих строках батча
+	batch := make(map[string]model.StoreData, len(list))
+	origins := make(map[string]string, len(list))
+	for _, d := range list {
+		if short, ok := m.idx.originShort(d.UserID, d.OriginalURL); ok && short != d.ShortURL {
+			return storage.ErrAddressConflict
+		}
+		if key, ok := m.dedupe.OriginKey(d.UserID, d.OriginalURL); ok {
+			if short, ok := origins[key]; ok && short != d.ShortURL {
+				return storage.ErrAddressConflict
+			}
+			origins[key] = d.ShortURL
+		}
+		if old, ok := m.idx.get(d.ShortURL); ok && m.dedupe.Taken(old, d) {
+			return storage.ErrShortConflict
+		}
+		if prev, ok := batch[d.ShortURL]; ok && m.dedupe.Taken(prev, d) {
+			return storage.ErrShortConflict
+		}
+		batch[d.ShortURL] = d
+	}
+
+	return m.write(dataRecords(opUpdate, list)...)
+}
+
+// запись изменений в журнал и индекс, вызывается под блокировкой
+func (m *MemStore) write(records ...journalRecord) error {
+	if err := m.fs.Append(records...); err != nil {
 		return err
 	}
 
-	for _, d := range list {
-		m.addrList[d.ShortURL] = d
-		m.savingAddr[d.OriginalURL] = true
+	for _, rec := range records {
+		m.idx.apply(rec)
 	}
 	return nil
 }
@@ -142,13 +352,7 @@ func (m *MemStore) GetUserURLs(ctx context.Context, userID string) ([]model.Stor
 	default:
 	}
 
-	res := make([]model.StoreData, 0)
-	for _, v := range m.addrList {
-		if v.UserID == userID {
-			res = append(res, v)
-		}
-	}
-	return res, nil
+	return m.idx.userURLs(userID), nil
 }
 
 // Пометка на удаление
@@ -159,32 +363,142 @@ func (m *MemStore) DeleteShort(ctx context.Context, shortURLs []string) error {
 	default:
 	}
 
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	// в журнал попадают только существующие ссылки
+	shorts := make([]string, 0, len(shortURLs))
+	for _, short := range shortURLs {
+		if _, ok := m.idx.get(short); ok {
+			shorts = append(shorts, short)
+		}
+	}
+	if len(shorts) == 0 {
+		return nil
+	}
+
+	return m.write(deleteRecord(shorts))
+}
+
+// Пометка на удаление ссылок пользователя
+func (m *MemStore) DeleteUserShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	var shorts []string
+	seen := make(map[string]bool, len(shortURLs))
 	for _, short := range shortURLs {
-		data, ok := m.addrList[short]
-		if ok {
-			data.DeletedFlag = true
-			m.addrList[short] = data
+		data, ok := m.idx.get(short)
+		if ok && data.UserID == userID && !data.DeletedFlag && !seen[short] {
+			seen[short] = true
+			shorts = append(shorts, short)
 		}
 	}
+	if len(shorts) == 0 {
+		return nil, nil
+	}
 
-	return nil
+	if err := m.write(deleteRecord(shorts)); err != nil {
+		return nil, err
+	}
+	return shorts, nil
 }
 
-// Пометка на удаление
-func (m *MemStore) Stats(ctx context.Context) (URLs int, users int, err error) {
+// Снятие пометки на удаление с неочищенных ссылок пользователя
+func (m *MemStore) RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
 	select {
 	case <-ctx.Done():
-		return 0, 0, ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
-	URLs = len(m.addrList)
+	m.mx.Lock()
+	defer m.mx.Unlock()
 
-	// пользователи могут повторяться, группируем
-	usrGrp := make(map[string]bool, URLs)
-	for _, d := range m.addrList {
-		usrGrp[d.UserID] = true
+	var shorts []string
+	for _, short := range shortURLs {
+		data, ok := m.idx.get(short)
+		if ok && data.UserID == userID && data.DeletedFlag && !data.Purged() {
+			shorts = append(shorts, short)
+		}
+	}
+	if len(shorts) == 0 {
+		return nil, nil
+	}
+
+	if err := m.write(journalRecord{Op: opRestore, Shorts: shorts}); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// Пометка на удаление ссылок с истёкшим сроком
+func (m *MemStore) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	shorts := m.idx.expired(now, limit)
+	if len(shorts) == 0 {
+		return nil, nil
+	}
+	if err := m.write(deleteRecord(shorts)); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// Окончательное удаление ссылок, помеченных на удаление не позже before
+func (m *MemStore) PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) ([]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	shorts := m.idx.deleted(before, limit, free)
+	if len(shorts) == 0 {
+		return nil, nil
+	}
+
+	op := opPurge
+	if free {
+		op = opRemove
+	}
+	if err := m.write(journalRecord{Op: op, Shorts: shorts}); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// запись пометки на удаление с текущим временем
+func deleteRecord(shorts []string) journalRecord {
+	now := time.Now().UTC()
+	return journalRecord{Op: opDelete, Shorts: shorts, Time: &now}
+}
+
+// Статистика хранилища, удалённые ссылки не учитываются
+func (m *MemStore) Stats(ctx context.Context) (URLs int, users int, err error) {
+	select {
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	default:
 	}
-	users = len(usrGrp)
+
+	URLs, users = m.idx.stats()
 	return
 }
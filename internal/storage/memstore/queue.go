@@ -0,0 +1,67 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// Утверждение типа, ошибка компиляции
+var _ storage.DeleteQueue = (*MemStore)(nil)
+
+// EnqueueDelete постановка задачи удаления в очередь.
+// Очередь пишется в журнал и без файла не переживает перезапуск.
+func (m *MemStore) EnqueueDelete(ctx context.Context, job model.DeleteJob) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if _, ok := m.idx.jobs[job.ID]; ok {
+		return nil
+	}
+	return m.write(enqueueRecord(job))
+}
+
+// PendingDeletes неподтверждённые задачи удаления
+func (m *MemStore) PendingDeletes(ctx context.Context) ([]model.DeleteJob, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return m.idx.pendingJobs(), nil
+}
+
+// AckDeletes удаление выполненных задач из очереди
+func (m *MemStore) AckDeletes(ctx context.Context, jobIDs []string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	// в журнал попадают только задачи из очереди
+	ids := make([]string, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		if _, ok := m.idx.jobs[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.write(journalRecord{Op: opAck, Jobs: ids})
+}
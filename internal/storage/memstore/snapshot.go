@@ -0,0 +1,127 @@
+package memstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+// расширение файла снимка рядом с журналом
+const snapshotExt = ".snapshot"
+
+// Снимок состояния хранилища.
+// Записывается атомарно: во временный файл, fsync, переименование.
+// После записи снимка журнал обрезается.
+func (fs *fileStorage) Snapshot(list []model.StoreData, jobs []model.DeleteJob) error {
+	if fs == nil {
+		return nil
+	}
+
+	fname := fs.name + snapshotExt
+	tmp, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// при ошибке временный файл не нужен
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err = encodeSnapshot(w, list, jobs); err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error write snapshot: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), fname); err != nil {
+		return err
+	}
+	if err = syncDir(filepath.Dir(fname)); err != nil {
+		return err
+	}
+
+	// всё содержимое журнала уже в снимке
+	if err = fs.file.Truncate(0); err != nil {
+		return err
+	}
+	if err = fs.file.Sync(); err != nil {
+		return err
+	}
+	fs.dirty = false
+	fs.records = 0
+	return nil
+}
+
+// чтение снимка, отсутствие файла не ошибка
+func readSnapshot(fname string) ([]journalRecord, error) {
+	file, err := os.Open(fname + snapshotExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// строки без ограничения длины: задача удаления может быть длиннее буфера сканера
+	res := make([]journalRecord, 0, 8)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			rec, derr := decodeRecord(bytes.TrimRight(line, "\r\n"))
+			if derr != nil {
+				return nil, fmt.Errorf("error read snapshot: %w", derr)
+			}
+			res = append(res, rec)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// снимок хранится в формате журнала, по записи на ссылку
+// и на невыполненную задачу удаления
+func encodeSnapshot(w *bufio.Writer, list []model.StoreData, jobs []model.DeleteJob) error {
+	records := dataRecords(opUpdate, list)
+	for _, job := range jobs {
+		records = append(records, enqueueRecord(job))
+	}
+
+	for _, rec := range records {
+		line, err := encodeRecord(rec)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsync каталога, чтобы переименование пережило сбой питания
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
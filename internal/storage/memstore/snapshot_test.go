@@ -0,0 +1,165 @@
+// Тестирование снимков и сжатия журнала
+
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+)
+
+func TestCompact(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	// батч перезаписывает одни и те же ссылки
+	for i := 0; i < 10; i++ {
+		err = store.Update(ctx, []model.StoreData{
+			{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+			{UserID: fmt.Sprintf("user%d", i), ShortURL: "s2", OriginalURL: "go.dev"},
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.DeleteShort(ctx, []string{"s1"}))
+	require.Equal(t, 21, store.fs.records)
+
+	require.NoError(t, store.Compact())
+	assert.Equal(t, 0, store.fs.records)
+
+	info, err := os.Stat(fname)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	// после снимка журнал продолжает писаться
+	err = store.Set(ctx, model.StoreData{UserID: "user", ShortURL: "s3", OriginalURL: "google.com"})
+	require.NoError(t, err)
+
+	want, err := store.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.Equal(t, 1, store.fs.records)
+
+	got, err := store.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+
+	// нумерация записей продолжается после снимка
+	err = store.Set(ctx, model.StoreData{UserID: "user", ShortURL: "s4", OriginalURL: "bing.com"})
+	require.NoError(t, err)
+	data, err := store.GetAddr(ctx, "s4")
+	require.NoError(t, err)
+	assert.Equal(t, "22", data.ID)
+}
+
+func TestCompactCrashBeforeTruncate(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	err = store.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteShort(ctx, []string{"s1"}))
+	err = store.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s3", OriginalURL: "google.com"},
+	})
+	require.NoError(t, err)
+
+	want, err := store.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+
+	// снимок записан, а журнал обрезать не успели
+	journal, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	require.NoError(t, store.Compact())
+	require.NoError(t, store.Close())
+	require.NoError(t, os.WriteFile(fname, journal, 0666))
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+}
+
+func TestBackgroundCompaction(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname, WithCompaction(5, 10*time.Millisecond))
+	require.NoError(t, err)
+	defer store.Close()
+
+	for i := 0; i < 5; i++ {
+		err = store.Update(ctx, []model.StoreData{
+			{UserID: fmt.Sprintf("user%d", i), ShortURL: "s1", OriginalURL: "ya.ru"},
+		})
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(fname + snapshotExt)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	assert.Less(t, store.fs.records, 5)
+}
+
+func TestReadSnapshotError(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	require.NoError(t, os.WriteFile(fname+snapshotExt, []byte("[\n"), 0666))
+
+	_, err := New(fname)
+	require.Error(t, err)
+}
+
+func TestSnapshotLongRecord(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname)
+	require.NoError(t, err)
+
+	// запись длиннее буфера bufio.Scanner
+	data := model.StoreData{
+		UserID:      "user",
+		ShortURL:    "s1",
+		OriginalURL: "http://ya.ru/?q=" + strings.Repeat("a", 100*1024),
+	}
+	require.NoError(t, store.Set(ctx, data))
+	require.NoError(t, store.Compact())
+	require.NoError(t, store.Close())
+
+	store, err = New(fname)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, data.OriginalURL, got.OriginalURL)
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -91,21 +93,20 @@ func TestSetAddr(t *testing.T) {
 func TestUpdateAddr(t *testing.T) {
 
 	var cases = []struct {
-		addr  string
-		short string
+		addr     string
+		short    string
+		conflict error // адрес занят другой короткой ссылкой или ссылка - другим адресом
 	}{
-		{"", ""},
-		{"ya.ru", ""},
-		{"", "t1"},
-		{"ya.ru", "t1"},
-		{"http://ya.ru", "t1"},
-		{"https://ya.ru", "t1"},
-		{"https://yandex.ru", "t1"},
-		{"http://ya.ru", "t1"},
-		{"ya.ru", "t2"},
+		{"ya.ru", "t1", nil},
+		{"ya.ru", "t1", nil},
+		{"ya.ru", "t2", storage.ErrAddressConflict},
+		{"http://ya.ru", "t1", storage.ErrShortConflict},
+		{"http://ya.ru", "t2", nil},
+		{"https://yandex.ru", "t1", storage.ErrShortConflict},
+		{"https://yandex.ru", "t3", nil},
 	}
 
-	storage, err := New("")
+	store, err := New("")
 	require.NoError(t, err)
 
 	ctx, close := context.WithCancel(context.Background())
@@ -115,12 +116,16 @@ func TestUpdateAddr(t *testing.T) {
 			{OriginalURL: c.addr, ShortURL: c.short},
 		}
 
-		err = storage.Update(ctx, data)
+		err = store.Update(ctx, data)
+		if c.conflict != nil {
+			require.ErrorIs(t, err, c.conflict)
+			continue
+		}
 		if err != nil {
 			t.Error(err)
 		}
 
-		get, err := storage.GetAddr(ctx, c.short)
+		get, err := store.GetAddr(ctx, c.short)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -132,7 +137,7 @@ func TestUpdateAddr(t *testing.T) {
 	}
 
 	close()
-	err = storage.Update(ctx, nil)
+	err = store.Update(ctx, nil)
 	require.Error(t, err)
 }
 
@@ -279,3 +284,55 @@ func BenchmarkGetUserURLs(b *testing.B) {
 		}
 	}
 }
+
+func TestStorage(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storage {
+			store, err := New("")
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		})
+	})
+
+	t.Run("file", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storage {
+			store, err := New(filepath.Join(t.TempDir(), "short-url-db.json"))
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		})
+	})
+
+	t.Run("dedupe", func(t *testing.T) {
+		storagetest.RunDedupe(t, func(t *testing.T, scope storage.DedupeScope) storage.Storage {
+			store, err := New(filepath.Join(t.TempDir(), "short-url-db.json"), WithDedupe(scope))
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		})
+	})
+}
+
+// индекс адресов строится заново при смене области уникальности
+func TestDedupeRestart(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "short-url-db.json")
+	ctx := context.Background()
+
+	store, err := New(fname, WithDedupe(storage.DedupeUser))
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "a", ShortURL: "s1", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "b", ShortURL: "s2", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Close())
+
+	store, err = New(fname, WithDedupe(storage.DedupeGlobal))
+	require.NoError(t, err)
+	defer store.Close()
+
+	// адрес занят для всех
+	err = store.Set(ctx, model.StoreData{UserID: "c", ShortURL: "s3", OriginalURL: "ya.ru"})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+	get, err := store.GetByOrigin(ctx, "c", "ya.ru")
+	require.NoError(t, err)
+	assert.Contains(t, []string{"s1", "s2"}, get.ShortURL)
+}
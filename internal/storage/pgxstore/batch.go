@@ -0,0 +1,194 @@
+package pgxstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// С какого размера батча строки передаются через COPY во временную таблицу.
+// Меньшие батчи уходят массивами в одном запросе.
+const copyThreshold = 1000
+
+// Колонки батча во временной таблице и в массивах
+var batchColumns = []string{"short_url", "origin_url", "user_id", "is_deleted", "expires_at", "deleted_at"}
+
+// Слияние батча с таблицей одним запросом.
+// Строки, чей полный адрес занят другой короткой ссылкой, не пишутся.
+// Короткая ссылка другого адреса не заменяется.
+// Возвращается число записанных строк и признаки обоих конфликтов.
+// Параметры: источник батча и условия области уникальности из mergeConditions.
+const mergeQuery = `
+	WITH batch AS (
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM %[1]s
+	), conflicted AS (
+		SELECT b.short_url FROM batch b
+		JOIN address a ON a.origin_url = b.origin_url AND a.short_url <> b.short_url%[2]s
+	), taken AS (
+		SELECT b.short_url FROM batch b
+		JOIN address a ON a.short_url = b.short_url AND (a.origin_url <> b.origin_url%[3]s)
+	), merged AS (
+		INSERT INTO address (short_url, origin_url, user_id, is_deleted, expires_at, deleted_at)
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM batch
+		WHERE short_url NOT IN (SELECT short_url FROM conflicted)
+			AND short_url NOT IN (SELECT short_url FROM taken)
+		ON CONFLICT (short_url)
+		DO UPDATE SET
+			user_id=excluded.user_id,
+			is_deleted=excluded.is_deleted, expires_at=excluded.expires_at,
+			deleted_at=excluded.deleted_at
+		WHERE address.origin_url = excluded.origin_url%[4]s
+		RETURNING short_url
+	)
+	SELECT (SELECT count(*) FROM merged),
+		EXISTS (SELECT 1 FROM conflicted),
+		EXISTS (SELECT 1 FROM taken)`
+
+// источник батча из массивов параметров
+const unnestSource = `unnest($1::text[], $2::text[], $3::text[], $4::bool[],
+			$5::timestamptz[], $6::timestamptz[])
+			AS t(short_url, origin_url, user_id, is_deleted, expires_at, deleted_at)`
+
+// временная таблица батча, удаляется вместе с транзакцией
+const createBatchTable = `
+	CREATE TEMP TABLE address_batch (
+		short_url  TEXT,
+		origin_url TEXT,
+		user_id    TEXT,
+		is_deleted BOOLEAN,
+		expires_at TIMESTAMPTZ,
+		deleted_at TIMESTAMPTZ
+	) ON COMMIT DROP`
+
+// Запись батча в одной транзакции, любой конфликт отменяет весь батч
+func (p *PgxStore) updateBatch(ctx context.Context, list []model.StoreData) error {
+	rows, err := prepareBatch(list, p.scope)
+	if err != nil {
+		return err
+	}
+	storage.MarkWritten(ctx)
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback(context.Background(), tx)
+
+	if err = mergeRows(ctx, tx, p.scope, rows); err != nil {
+		// адрес заняли параллельно между проверкой и вставкой
+		if isConstraintViolation(err) {
+			err = storage.ErrAddressConflict
+		}
+		return err
+	}
+
+	shorts := make([]string, len(rows))
+	for i, d := range rows {
+		shorts[i] = d.ShortURL
+	}
+	if err = notify(ctx, tx, shorts); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Подготовка батча, как в memstore: повтор короткой ссылки с другим адресом
+// или владельцем - ErrShortConflict, повтор полного адреса в области уникальности
+// с другой короткой ссылкой - ErrAddressConflict.
+// Из совместимых повторов короткой ссылки пишется последний.
+func prepareBatch(list []model.StoreData, scope storage.DedupeScope) ([]model.StoreData, error) {
+	rows := make([]model.StoreData, 0, len(list))
+	shorts := make(map[string]int, len(list))
+	origins := make(map[string]string, len(list))
+
+	for _, d := range list {
+		if key, ok := scope.OriginKey(d.UserID, d.OriginalURL); ok {
+			if short, ok := origins[key]; ok && short != d.ShortURL {
+				return nil, storage.ErrAddressConflict
+			}
+			origins[key] = d.ShortURL
+		}
+		if i, ok := shorts[d.ShortURL]; ok {
+			if scope.Taken(rows[i], d) {
+				return nil, storage.ErrShortConflict
+			}
+			rows[i] = d
+			continue
+		}
+		shorts[d.ShortURL] = len(rows)
+		rows = append(rows, d)
+	}
+	return rows, nil
+}
+
+// Слияние строк с таблицей.
+// Конфликт хотя бы одной строки возвращается ошибкой хранилища.
+func mergeRows(ctx context.Context, tx pgx.Tx, scope storage.DedupeScope, rows []model.StoreData) error {
+	var (
+		row pgx.Row
+		err error
+	)
+
+	origin, owner, update := mergeConditions(scope)
+	query := func(source string) string {
+		return fmt.Sprintf(mergeQuery, source, origin, owner, update)
+	}
+
+	if len(rows) >= copyThreshold {
+		if _, err = tx.Exec(ctx, createBatchTable); err != nil {
+			return err
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"address_batch"}, batchColumns,
+			pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+				d := rows[i]
+				return []any{d.ShortURL, d.OriginalURL, d.UserID, d.DeletedFlag,
+					d.ExpiresAt, d.DeletedAt}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("error copy batch: %w", err)
+		}
+		row = tx.QueryRow(ctx, query("address_batch"))
+	} else {
+		var (
+			shorts  = make([]string, len(rows))
+			origins = make([]string, len(rows))
+			users   = make([]string, len(rows))
+			deleted = make([]bool, len(rows))
+			expires = make([]*time.Time, len(rows))
+			deletes = make([]*time.Time, len(rows))
+		)
+		for i, d := range rows {
+			shorts[i] = d.ShortURL
+			origins[i] = d.OriginalURL
+			users[i] = d.UserID
+			deleted[i] = d.DeletedFlag
+			expires[i] = d.ExpiresAt
+			deletes[i] = d.DeletedAt
+		}
+		row = tx.QueryRow(ctx, query(unnestSource),
+			shorts, origins, users, deleted, expires, deletes)
+	}
+
+	var (
+		written           int
+		conflicted, taken bool
+	)
+	if err = row.Scan(&written, &conflicted, &taken); err != nil {
+		return err
+	}
+	switch {
+	case conflicted:
+		return storage.ErrAddressConflict
+	case taken:
+		return storage.ErrShortConflict
+	case written < len(rows):
+		// строку не заменило условие обновления
+		return storage.ErrShortConflict
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Тестирование подготовки батча
+
+package pgxstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+func TestPrepareBatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope storage.DedupeScope
+		list  []model.StoreData
+		rows  []model.StoreData
+		err   error
+	}{
+		{
+			name: "empty",
+			rows: []model.StoreData{},
+		},
+		{
+			name: "unique",
+			list: []model.StoreData{
+				{ShortURL: "s1", OriginalURL: "a1"},
+				{ShortURL: "s2", OriginalURL: "a2"},
+			},
+			rows: []model.StoreData{
+				{ShortURL: "s1", OriginalURL: "a1"},
+				{ShortURL: "s2", OriginalURL: "a2"},
+			},
+		},
+		{
+			name: "same short",
+			list: []model.StoreData{
+				{ShortURL: "s1", OriginalURL: "a1"},
+				{ShortURL: "s2", OriginalURL: "a2"},
+				{ShortURL: "s1", OriginalURL: "a1", DeletedFlag: true},
+			},
+			rows: []model.StoreData{
+				{ShortURL: "s1", OriginalURL: "a1", DeletedFlag: true},
+				{ShortURL: "s2", OriginalURL: "a2"},
+			},
+		},
+		{
+			name: "same short other origin",
+			list: []model.StoreData{
+				{ShortURL: "s1", OriginalURL: "a1"},
+				{ShortURL: "s1", OriginalURL: "b1"},
+			},
+			err: storage.ErrShortConflict,
+		},
+		{
+			name:  "same short other user",
+			scope: storage.DedupeUser,
+			list: []model.StoreData{
+				{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+				{UserID: "u2", ShortURL: "s1", OriginalURL: "a1"},
+			},
+			err: storage.ErrShortConflict,
+		},
+		{
+			name: "same origin",
+			list: []model.StoreData{
+				{ShortURL: "s1", OriginalURL: "a1"},
+				{ShortURL: "s2", OriginalURL: "a1"},
+			},
+			err: storage.ErrAddressConflict,
+		},
+		{
+			name:  "same origin other user",
+			scope: storage.DedupeUser,
+			list: []model.StoreData{
+				{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+				{UserID: "u2", ShortURL: "s2", OriginalURL: "a1"},
+			},
+			rows: []model.StoreData{
+				{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+				{UserID: "u2", ShortURL: "s2", OriginalURL: "a1"},
+			},
+		},
+		{
+			name:  "same origin without dedupe",
+			scope: storage.DedupeNone,
+			list: []model.StoreData{
+				{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+				{UserID: "u1", ShortURL: "s2", OriginalURL: "a1"},
+			},
+			rows: []model.StoreData{
+				{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+				{UserID: "u1", ShortURL: "s2", OriginalURL: "a1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := prepareBatch(tt.list, tt.scope)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.rows, rows)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package pgxstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// WithDedupe область уникальности полного адреса, по умолчанию storage.DedupeGlobal.
+// При смене области уникальный индекс адресов пересоздаётся при запуске.
+func WithDedupe(scope storage.DedupeScope) Option {
+	return func(p *PgxStore) {
+		p.scope = scope
+	}
+}
+
+// Уникальный индекс адресов для области scope, индекс другой области удаляется.
+// Выполняется под блокировкой миграций, чтобы экземпляры не мешали друг другу.
+// Очищенные удалённые ссылки хранятся с пустым адресом,
+// поэтому уникальность только у непустых.
+// Миграции, меняющие индекс адресов, сохраняют его область.
+func ensureDedupe(ctx context.Context, pool *pgxpool.Pool, scope storage.DedupeScope) error {
+	query := `
+		DROP INDEX IF EXISTS origin_user_idx;
+		CREATE UNIQUE INDEX IF NOT EXISTS origin_url_idx
+		ON address (origin_url) WHERE origin_url <> '';`
+	switch scope {
+	case storage.DedupeUser:
+		query = `
+			DROP INDEX IF EXISTS origin_url_idx;
+			CREATE UNIQUE INDEX IF NOT EXISTS origin_user_idx
+			ON address (origin_url, user_id) WHERE origin_url <> '';`
+	case storage.DedupeNone:
+		query = `
+			DROP INDEX IF EXISTS origin_url_idx;
+			DROP INDEX IF EXISTS origin_user_idx;`
+	}
+
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		if _, err := conn.Exec(ctx, query); err != nil {
+			return fmt.Errorf("error set dedupe scope %q: %w", scope, err)
+		}
+		return nil
+	})
+}
+
+// Условия слияния батча для области уникальности: дополнения к поиску
+// занятого адреса, к проверке занятой ссылки и к условию её обновления.
+// Вне общей уникальности чужая ссылка на тот же адрес остаётся за владельцем.
+func mergeConditions(scope storage.DedupeScope) (origin, taken, update string) {
+	switch scope {
+	case storage.DedupeUser:
+		origin = " AND a.user_id = b.user_id"
+	case storage.DedupeNone:
+		origin = " AND false"
+	default:
+		return "", "", ""
+	}
+	return origin, " OR a.user_id <> b.user_id", " AND address.user_id = excluded.user_id"
+}
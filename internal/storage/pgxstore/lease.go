@@ -0,0 +1,47 @@
+package pgxstore
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// ключ блокировки выдачи блоков номеров
+const leaseLockKey int64 = 0x73686f72745f6964
+
+// Утверждение типа, ошибка компиляции
+var _ storage.IDLeaser = (*PgxStore)(nil)
+
+// LeaseIDs блок из n номеров последовательности short_id_seq.
+// Последовательность не откатывается вместе с транзакцией и после сбоя
+// только забегает вперёд, поэтому выданные блоки не повторяются.
+// Блокировка нужна, чтобы nextval других экземпляров не попал внутрь блока.
+func (p *PgxStore) LeaseIDs(ctx context.Context, n uint64) (uint64, error) {
+	if n == 0 || n > math.MaxInt64 {
+		return 0, errors.New("wrong id block size")
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(context.Background(), tx)
+
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, leaseLockKey); err != nil {
+		return 0, err
+	}
+
+	var start int64
+	err = tx.QueryRow(ctx,
+		`SELECT setval('short_id_seq', nextval('short_id_seq') + $1 - 1) - $1 + 1`,
+		int64(n)).Scan(&start)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return uint64(start), nil
+}
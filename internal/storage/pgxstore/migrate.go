@@ -0,0 +1,254 @@
+package pgxstore
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/eugene982/url-shortener/internal/logger"
+)
+
+// Скрипты миграций вида 0001_name.up.sql и 0001_name.down.sql
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// ключ рекомендательной блокировки, общий для всех экземпляров сервиса
+const migrationLockKey int64 = 0x75726c73686f7274
+
+// Migration версия схемы базы со скриптами применения и отката
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations все встроенные миграции по возрастанию версии
+func Migrations() ([]Migration, error) {
+	sub, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return loadMigrations(sub)
+}
+
+// чтение скриптов миграций из каталога
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, fname := range names {
+		base, up := strings.CutSuffix(path.Base(fname), ".up.sql")
+		if !up {
+			var down bool
+			if base, down = strings.CutSuffix(base, ".down.sql"); !down {
+				return nil, fmt.Errorf("wrong migration file name %q", fname)
+			}
+		}
+		num, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("wrong migration version %q", fname)
+		}
+
+		script, err := fs.ReadFile(fsys, fname)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has different names %q and %q", version, m.Name, name)
+		}
+
+		if up {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d %q has no up script", m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+	return res, nil
+}
+
+// MigrateUp применение ещё не применённых миграций, не больше n.
+// При n <= 0 применяются все.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool, n int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			if err = runMigration(ctx, conn, m.Version, m.Name, m.Up, true); err != nil {
+				return err
+			}
+			if n--; n == 0 {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown откат n последних применённых миграций
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, n int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && n > 0; i-- {
+			m := migrations[i]
+			if !applied[m.Version] {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d %q has no down script", m.Version, m.Name)
+			}
+			if err = runMigration(ctx, conn, m.Version, m.Name, m.Down, false); err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// SchemaVersion применённая и последняя известная версии схемы
+func SchemaVersion(ctx context.Context, pool *pgxpool.Pool) (current int, latest int, err error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	err = withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		return conn.QueryRow(ctx,
+			`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	})
+	return current, latest, err
+}
+
+// Выполнение под рекомендательной блокировкой.
+// Экземпляры, стартующие одновременно, применяют миграции по очереди.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	// блокировка принадлежит сессии, поэтому всё в одном соединении
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("error lock migrations: %w", err)
+	}
+	defer func() {
+		_, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+		if err != nil {
+			logger.Error(fmt.Errorf("error unlock migrations: %w", err))
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int]bool, error) {
+	rows, _ := conn.Query(ctx, `SELECT version FROM schema_migrations`)
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		res[int(v)] = true
+	}
+	return res, nil
+}
+
+// скрипт и отметка о нём в одной транзакции
+func runMigration(ctx context.Context, conn *pgxpool.Conn, version int, name, script string, up bool) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer rollback(context.Background(), tx)
+
+	// без параметров скрипт уходит простым протоколом и может содержать несколько команд
+	if _, err = tx.Exec(ctx, script); err != nil {
+		return fmt.Errorf("migration %d %q: %w", version, name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, version, name)
+	} else {
+		_, err = tx.Exec(ctx,
+			`DELETE FROM schema_migrations WHERE version=$1`, version)
+	}
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	logger.Info("schema migrated", "version", version, "name", name, "direction", direction)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Тестирование чтения миграций
+
+package pgxstore
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	list, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, list)
+
+	for i, m := range list {
+		assert.Equal(t, i+1, m.Version, "versions without gaps")
+		assert.NotEmpty(t, m.Up, m.Name)
+		assert.NotEmpty(t, m.Down, m.Name)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(s)}
+	}
+
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			fsys: fstest.MapFS{},
+			want: []Migration{},
+		},
+		{
+			name: "sorted",
+			fsys: fstest.MapFS{
+				"0010_ten.up.sql":   file("up10"),
+				"0002_two.up.sql":   file("up2"),
+				"0002_two.down.sql": file("down2"),
+				"readme.txt":        file("-"),
+			},
+			want: []Migration{
+				{Version: 2, Name: "two", Up: "up2", Down: "down2"},
+				{Version: 10, Name: "ten", Up: "up10"},
+			},
+		},
+		{
+			name:    "wrong direction",
+			fsys:    fstest.MapFS{"0001_one.sql": file("-")},
+			wantErr: true,
+		},
+		{
+			name:    "wrong version",
+			fsys:    fstest.MapFS{"one.up.sql": file("-")},
+			wantErr: true,
+		},
+		{
+			name:    "no up",
+			fsys:    fstest.MapFS{"0001_one.down.sql": file("-")},
+			wantErr: true,
+		},
+		{
+			name: "different names",
+			fsys: fstest.MapFS{
+				"0001_one.up.sql":     file("-"),
+				"0001_first.down.sql": file("-"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.fsys)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+-- таблица могла быть создана до появления миграций
+CREATE TABLE IF NOT EXISTS address (
+	short_url  VARCHAR (20) PRIMARY KEY,
+	origin_url TEXT NOT NULL,
+	user_id    VARCHAR (36) NOT NULL,
+	is_deleted BOOLEAN NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS origin_url_idx
+ON address (origin_url);
+CREATE INDEX IF NOT EXISTS user_id_idx
+ON address (user_id);
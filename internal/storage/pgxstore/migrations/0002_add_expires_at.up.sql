@@ -0,0 +1,6 @@
+-- срок действия ссылки, NULL - бессрочная
+ALTER TABLE address ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- поиск истёкших ссылок для пометки на удаление
+CREATE INDEX IF NOT EXISTS expires_at_idx
+ON address (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;
@@ -0,0 +1,19 @@
+-- очищенные ссылки не пройдут проверку уникальности адреса
+DELETE FROM address WHERE origin_url = '';
+
+-- индекс возвращается в той же области уникальности
+DO $$
+BEGIN
+	IF to_regclass('origin_user_idx') IS NOT NULL THEN
+		DROP INDEX origin_user_idx;
+		CREATE UNIQUE INDEX origin_user_idx
+		ON address (origin_url, user_id);
+	ELSIF to_regclass('origin_url_idx') IS NOT NULL THEN
+		DROP INDEX origin_url_idx;
+		CREATE UNIQUE INDEX origin_url_idx
+		ON address (origin_url);
+	END IF;
+END $$;
+
+DROP INDEX IF EXISTS deleted_at_idx;
+ALTER TABLE address DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,24 @@
+-- время пометки на удаление, для удалённых ранее отсчёт хранения начинается сейчас
+ALTER TABLE address ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+UPDATE address SET deleted_at = now() WHERE is_deleted AND deleted_at IS NULL;
+
+-- поиск удалённых ссылок для окончательного удаления
+CREATE INDEX IF NOT EXISTS deleted_at_idx
+ON address (deleted_at) WHERE is_deleted;
+
+-- очищенные удалённые ссылки хранятся с пустым адресом,
+-- поэтому уникальность только у непустых.
+-- Индекс остаётся в области уникальности, заданной при запуске:
+-- общей или по пользователю, без уникальности индекса нет
+DO $$
+BEGIN
+	IF to_regclass('origin_user_idx') IS NOT NULL THEN
+		DROP INDEX origin_user_idx;
+		CREATE UNIQUE INDEX origin_user_idx
+		ON address (origin_url, user_id) WHERE origin_url <> '';
+	ELSIF to_regclass('origin_url_idx') IS NOT NULL THEN
+		DROP INDEX origin_url_idx;
+		CREATE UNIQUE INDEX origin_url_idx
+		ON address (origin_url) WHERE origin_url <> '';
+	END IF;
+END $$;
@@ -0,0 +1,7 @@
+-- задачи удаления ссылок, ещё не выполненные
+CREATE TABLE IF NOT EXISTS delete_queue (
+	job_id     TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	short_urls TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
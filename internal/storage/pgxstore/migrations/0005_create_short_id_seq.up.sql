@@ -0,0 +1,2 @@
+-- номера счётчика коротких ссылок, выдаются экземплярам блоками
+CREATE SEQUENCE IF NOT EXISTS short_id_seq AS BIGINT MINVALUE 0 START 0;
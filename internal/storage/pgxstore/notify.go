@@ -0,0 +1,121 @@
+package pgxstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/eugene982/url-shortener/internal/logger"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+const (
+	// канал оповещений об изменении ссылок
+	notifyChannel = "address_changed"
+	// предел полезной нагрузки NOTIFY 8000 байт, оставлен запас
+	notifyPayloadSize = 7000
+
+	// паузы между попытками переподключения слушателя
+	listenMinBackoff = 500 * time.Millisecond
+	listenMaxBackoff = 30 * time.Second
+)
+
+// Утверждение типа, ошибка компиляции
+var _ storage.ChangeListener = (*PgxStore)(nil)
+
+// Оповещение остальных экземпляров об изменённых ссылках.
+// В транзакции оповещение уходит только при её фиксации.
+func notify(ctx context.Context, tx pgx.Tx, shorts []string) error {
+	for _, payload := range notifyPayloads(shorts) {
+		if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, payload); err != nil {
+			return fmt.Errorf("error notify address change: %w", err)
+		}
+	}
+	return nil
+}
+
+// Разбиение ссылок на JSON-массивы, умещающиеся в одно оповещение
+func notifyPayloads(shorts []string) []string {
+	var (
+		res   []string
+		chunk []string
+		size  int
+	)
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		b, _ := json.Marshal(chunk)
+		res = append(res, string(b))
+		chunk, size = chunk[:0], 0
+	}
+
+	for _, short := range shorts {
+		// строка в кавычках с экранированием и запятая
+		quoted, _ := json.Marshal(short)
+		n := len(quoted) + 1
+		if size+n > notifyPayloadSize {
+			flush()
+		}
+		chunk = append(chunk, short)
+		size += n
+	}
+	flush()
+	return res
+}
+
+// ListenChanges подписка на изменения ссылок, сделанные любым экземпляром сервиса.
+// Работает до отмены ctx, при потере соединения переподключается с нарастающей паузой.
+// Изменения, пропущенные без подписки, сбрасывают кеш целиком.
+func (p *PgxStore) ListenChanges(ctx context.Context, inv storage.Invalidator) {
+	backoff := listenMinBackoff
+	for {
+		err := p.listen(ctx, inv, func() { backoff = listenMinBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(fmt.Errorf("error listen address changes: %w", err), "retry", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > listenMaxBackoff {
+			backoff = listenMaxBackoff
+		}
+	}
+}
+
+// Одно соединение подписки, вне пула: LISTEN принадлежит сессии
+func (p *PgxStore) listen(ctx context.Context, inv storage.Invalidator, connected func()) error {
+	conn, err := pgx.ConnectConfig(ctx, p.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	connected()
+	logger.Info("listen address changes", "channel", notifyChannel)
+	inv.InvalidateAll()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var shorts []string
+		if err = json.Unmarshal([]byte(n.Payload), &shorts); err != nil {
+			logger.Error(fmt.Errorf("wrong address change payload: %w", err))
+			continue
+		}
+		inv.Invalidate(shorts...)
+	}
+}
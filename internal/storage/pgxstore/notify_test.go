@@ -0,0 +1,92 @@
+// Тестирование оповещений об изменении ссылок
+
+package pgxstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyPayloads(t *testing.T) {
+	many := make([]string, 3000)
+	for i := range many {
+		many[i] = fmt.Sprintf("short%d", i)
+	}
+
+	tests := []struct {
+		name   string
+		shorts []string
+		chunks int
+	}{
+		{"empty", nil, 0},
+		{"one", []string{"s1"}, 1},
+		{"escaped", []string{`"quoted"`, "\x00\x01"}, 1},
+		{"many", many, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := notifyPayloads(tt.shorts)
+			assert.Len(t, payloads, tt.chunks)
+
+			var got []string
+			for _, p := range payloads {
+				assert.LessOrEqual(t, len(p), notifyPayloadSize)
+
+				var chunk []string
+				require.NoError(t, json.Unmarshal([]byte(p), &chunk))
+				got = append(got, chunk...)
+			}
+			assert.Equal(t, tt.shorts, got)
+		})
+	}
+}
+
+// сброс кеша для проверки подписки
+type testInvalidator struct {
+	shorts chan []string
+	all    chan struct{}
+}
+
+func newTestInvalidator() *testInvalidator {
+	return &testInvalidator{
+		shorts: make(chan []string, 16),
+		all:    make(chan struct{}, 16),
+	}
+}
+
+func (i *testInvalidator) Invalidate(shorts ...string) {
+	i.shorts <- shorts
+}
+
+func (i *testInvalidator) InvalidateAll() {
+	i.all <- struct{}{}
+}
+
+func TestListenChangesCancel(t *testing.T) {
+	// база недоступна, слушатель переподключается до отмены
+	p := newReplicaStore(t, 0)
+	inv := newTestInvalidator()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.ListenChanges(ctx, inv)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener is not stopped")
+	}
+	assert.Empty(t, inv.all)
+}
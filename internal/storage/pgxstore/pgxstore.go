@@ -3,224 +3,514 @@ package pgxstore
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/jmoiron/sqlx"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/eugene982/url-shortener/internal/logger"
 	"github.com/eugene982/url-shortener/internal/model"
 	"github.com/eugene982/url-shortener/internal/storage"
 )
 
-const (
-	maxOpenConns    = 3               // максимум открытых соединений
-	maxIdleConns    = 3               // максимум ожидающих соединений
-	connMaxLifetime = time.Minute * 3 // таймаут ожидания соединния перед закрытием
-)
+// PoolConfig настройки пула соединений.
+// Нулевые значения оставляют настройки pgxpool по умолчанию.
+type PoolConfig struct {
+	MaxConns          int32         // максимум соединений
+	MinConns          int32         // минимум поддерживаемых соединений
+	MaxConnIdleTime   time.Duration // простой соединения перед закрытием
+	MaxConnLifetime   time.Duration // время жизни соединения
+	HealthCheckPeriod time.Duration // период проверки простаивающих соединений
+	ExecMode          string        // режим выполнения запросов и кеша подготовленных выражений
+}
 
+// Режимы выполнения запросов по названию, как в параметре default_query_exec_mode
+var execModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// PgxStore хранилище в postgres.
+// Запись всегда идёт в основную базу, чтение - на реплики, если они заданы.
 type PgxStore struct {
-	db *sqlx.DB
+	pool  *pgxpool.Pool
+	scope storage.DedupeScope // область уникальности адреса
+
+	replicas     []*replica
+	replicaCheck time.Duration
+	next         atomic.Uint32 // счётчик выбора реплики по кругу
+
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
 // Утверждение типа, ошибка компиляции
-var _ storage.Storage = (*PgxStore)(nil)
+var (
+	_ storage.Storage      = (*PgxStore)(nil)
+	_ storage.OriginGetter = (*PgxStore)(nil)
+)
 
-// New Функция-конструктор
-func New(db *sqlx.DB) (*PgxStore, error) {
-	err := db.Ping()
+// Open создание пула соединений по строке подключения
+func Open(ctx context.Context, dsn string, conf PoolConfig) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = createTableIfNonExists(db); err != nil {
+	if conf.MaxConns > 0 {
+		cfg.MaxConns = conf.MaxConns
+	}
+	if conf.MinConns > 0 {
+		cfg.MinConns = conf.MinConns
+	}
+	if conf.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = conf.MaxConnIdleTime
+	}
+	if conf.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = conf.MaxConnLifetime
+	}
+	if conf.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = conf.HealthCheckPeriod
+	}
+	if conf.ExecMode != "" {
+		mode, ok := execModes[conf.ExecMode]
+		if !ok {
+			return nil, fmt.Errorf("unknown database exec mode %q", conf.ExecMode)
+		}
+		cfg.ConnConfig.DefaultQueryExecMode = mode
+	}
+
+	return pgxpool.NewWithConfig(ctx, cfg)
+}
+
+// New Функция-конструктор
+func New(pool *pgxpool.Pool, opts ...Option) (*PgxStore, error) {
+	ctx := context.Background()
+
+	err := pool.Ping(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	// Настройка пула соединений
-	db.SetMaxOpenConns(maxOpenConns)
-	db.SetMaxIdleConns(maxIdleConns)
-	db.SetConnMaxLifetime(connMaxLifetime)
+	// При первом запуске база может быть пустая
+	if err = MigrateUp(ctx, pool, 0); err != nil {
+		return nil, fmt.Errorf("error migrate schema: %w", err)
+	}
+
+	p := &PgxStore{
+		pool:         pool,
+		scope:        storage.DedupeGlobal,
+		replicaCheck: defaultReplicaCheck,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if err = ensureDedupe(ctx, pool, p.scope); err != nil {
+		return nil, err
+	}
 
-	return &PgxStore{db}, nil
+	// недоступные при старте реплики подключатся после очередной проверки
+	p.checkReplicas(ctx)
+	for _, r := range p.replicas {
+		if !r.healthy.Load() {
+			logger.Warn("replica unavailable", "host", r.pool.Config().ConnConfig.Host)
+		}
+	}
+	if len(p.replicas) > 0 && p.replicaCheck > 0 {
+		p.wg.Add(1)
+		go p.startReplicaCheck()
+	}
+	return p, nil
 }
 
-// Close Закрытие соединения
+// Close Закрытие пулов соединений
 func (p *PgxStore) Close() error {
-	return p.db.Close()
+	close(p.stop)
+	p.wg.Wait()
+
+	p.closeReplicas()
+	p.pool.Close()
+	return nil
 }
 
 // Ping Пинг к базе
 func (p *PgxStore) Ping(ctx context.Context) error {
-	return p.db.PingContext(ctx)
+	return p.pool.Ping(ctx)
+}
+
+// PoolStats состояние пула соединений
+func (p *PgxStore) PoolStats() model.PoolStats {
+	st := p.pool.Stat()
+	return model.PoolStats{
+		MaxConns:                st.MaxConns(),
+		TotalConns:              st.TotalConns(),
+		AcquiredConns:           st.AcquiredConns(),
+		IdleConns:               st.IdleConns(),
+		AcquireCount:            st.AcquireCount(),
+		EmptyAcquireCount:       st.EmptyAcquireCount(),
+		CanceledAcquireCount:    st.CanceledAcquireCount(),
+		AcquireDuration:         st.AcquireDuration(),
+		NewConnsCount:           st.NewConnsCount(),
+		MaxLifetimeDestroyCount: st.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     st.MaxIdleDestroyCount(),
+	}
 }
 
 // GetAddr Запрос полного адреса у базы по короткой ссылке
 func (p *PgxStore) GetAddr(ctx context.Context, short string) (data model.StoreData, err error) {
 	query := `
-		SELECT * FROM address 
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
 		WHERE short_url=$1 LIMIT 1`
 
-	res := model.StoreData{}
-	if err = p.db.GetContext(ctx, &res, query, short); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return model.StoreData{}, storage.ErrAddressNotFound
+	err = p.read(ctx, func(pool *pgxpool.Pool) error {
+		rows, _ := pool.Query(ctx, query, short)
+		data, err = pgx.CollectOneRow(rows, scanData)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrAddressNotFound
 		}
+		return err
+	})
+	if err != nil {
 		return model.StoreData{}, err
 	}
-	return res, nil
+	return data, nil
+}
+
+// GetByOrigin Получение ссылки по полному адресу в области уникальности
+func (p *PgxStore) GetByOrigin(ctx context.Context, userID, origin string) (data model.StoreData, err error) {
+	query := `
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+		WHERE origin_url=$1 LIMIT 1`
+	args := []any{origin}
+
+	switch p.scope {
+	case storage.DedupeNone:
+		return model.StoreData{}, storage.ErrAddressNotFound
+	case storage.DedupeUser:
+		query = `
+			SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+			WHERE origin_url=$1 AND user_id=$2 LIMIT 1`
+		args = append(args, userID)
+	}
+
+	err = p.read(ctx, func(pool *pgxpool.Pool) error {
+		rows, _ := pool.Query(ctx, query, args...)
+		data, err = pgx.CollectOneRow(rows, scanData)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrAddressNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return model.StoreData{}, err
+	}
+	return data, nil
 }
 
 // Set Установка уникального соответствия
 func (p *PgxStore) Set(ctx context.Context, data model.StoreData) error {
-	tx, err := p.db.BeginTxx(ctx, nil)
-	if err != nil {
+	if ok, err := data.IsValid(); !ok {
 		return err
 	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			logger.Error(fmt.Errorf("psql rollbacck error: %w", err))
-		}
-	}()
 
+	storage.MarkWritten(ctx)
+	// оповещение в том же запросе снимает отметку об отсутствии ссылки в кешах
 	query := `
-		INSERT INTO address (origin_url, short_url, user_id, is_deleted) 
-		VALUES(:origin_url, :short_url, :user_id, :is_deleted);`
-	if _, err = tx.NamedExecContext(ctx, query, data); err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
-			err = storage.ErrAddressConflict
+		WITH ins AS (
+			INSERT INTO address (origin_url, short_url, user_id, is_deleted, expires_at, deleted_at)
+			VALUES($1, $2, $3, $4, $5, $6)
+			RETURNING short_url
+		)
+		SELECT pg_notify($7, json_build_array(short_url)::text) FROM ins`
+	_, err := p.pool.Exec(ctx, query, data.OriginalURL, data.ShortURL, data.UserID, data.DeletedFlag,
+		data.ExpiresAt, data.DeletedAt, notifyChannel)
+	if err == nil {
+		return nil
+	}
+
+	err = conflictError(err)
+	// первичный ключ проверяется раньше индекса адреса, а повтор
+	// уже сокращённого адреса - конфликт адреса, а не коллизия ссылки
+	if errors.Is(err, storage.ErrShortConflict) {
+		if _, gerr := p.GetByOrigin(ctx, data.UserID, data.OriginalURL); gerr == nil {
+			return storage.ErrAddressConflict
 		}
-		return err
 	}
-	return tx.Commit()
+	return err
 }
 
-// Update Записть в базу соответствия между адресом и короткой ссылкой
+// Update Записть в базу соответствия между адресом и короткой ссылкой.
+// Весь батч пишется одним запросом, конфликт отменяет батч целиком.
 func (p *PgxStore) Update(ctx context.Context, list []model.StoreData) error {
 	if len(list) == 0 {
 		return nil
 	}
+	return p.updateBatch(ctx, list)
+}
 
-	tx, err := p.db.BeginTxx(ctx, nil)
-	if err != nil {
+// GetUserURLs Получение данных пользователя
+func (p *PgxStore) GetUserURLs(ctx context.Context, userID string) ([]model.StoreData, error) {
+	query := `
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+		WHERE user_id=$1`
+
+	var res []model.StoreData
+	err := p.read(ctx, func(pool *pgxpool.Pool) (err error) {
+		rows, _ := pool.Query(ctx, query, userID)
+		res, err = pgx.CollectRows(rows, scanData)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			logger.Error(fmt.Errorf("psql rollbacck error: %w", err))
-		}
-	}()
-
-	stmt, err := tx.PrepareNamedContext(ctx, `
-		INSERT INTO address 
-			(origin_url, short_url, user_id, is_deleted) 
-		VALUES
-			(:origin_url, :short_url, :user_id, :is_deleted )
-		ON CONFLICT (short_url) 
-		DO UPDATE SET 
-			origin_url=:origin_url, short_url=:short_url,
-			user_id=:user_id, is_deleted=:is_deleted;`)
+	if res == nil {
+		res = make([]model.StoreData, 0)
+	}
+	return res, nil
+}
+
+// DeleteShort Удаление указанных сокращённых ссылок
+func (p *PgxStore) DeleteShort(ctx context.Context, shortURLs []string) error {
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	storage.MarkWritten(ctx)
+	// повторное удаление не сдвигает время пометки
+	query := `
+		UPDATE address SET is_deleted=TRUE, deleted_at=COALESCE(deleted_at, now())
+		WHERE short_url = ANY($1);`
+
+	tx, err := p.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer rollback(context.Background(), tx)
 
-	// Обновляем адреса которые есть в базе и добавляем новые, при отсутствии
-	for _, d := range list {
-		if _, err = stmt.ExecContext(ctx, d); err != nil {
-			return err
-		}
+	if _, err = tx.Exec(ctx, query, shortURLs); err != nil {
+		return err
 	}
-
-	return tx.Commit()
+	if err = notify(ctx, tx, shortURLs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// GetUserURLs Получение данных пользователя
-func (p *PgxStore) GetUserURLs(ctx context.Context, userID string) ([]model.StoreData, error) {
-	res := make([]model.StoreData, 0)
+// DeleteUserShort пометка на удаление ссылок пользователя одним запросом
+func (p *PgxStore) DeleteUserShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	if len(shortURLs) == 0 {
+		return nil, nil
+	}
 
+	storage.MarkWritten(ctx)
 	query := `
-		SELECT * FROM address 
-		WHERE user_id=$1`
+		UPDATE address SET is_deleted=TRUE, deleted_at=now()
+		WHERE user_id=$1 AND NOT is_deleted AND short_url = ANY($2)
+		RETURNING short_url`
 
-	err := p.db.SelectContext(ctx, &res, query, userID)
+	tx, err := p.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer rollback(context.Background(), tx)
 
-	return res, nil
+	rows, _ := tx.Query(ctx, query, userID, shortURLs)
+	shorts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if err = notify(ctx, tx, shorts); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return shorts, nil
 }
 
-// DeleteShort Удаление указанных сокращённых ссылок
-func (p *PgxStore) DeleteShort(ctx context.Context, shortURLs []string) error {
+// RestoreShort снятие пометки на удаление с неочищенных ссылок пользователя
+func (p *PgxStore) RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
 	if len(shortURLs) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	tx, err := p.db.BeginTxx(ctx, nil)
+	storage.MarkWritten(ctx)
+	query := `
+		UPDATE address SET is_deleted=FALSE, deleted_at=NULL
+		WHERE user_id=$1 AND is_deleted AND origin_url <> '' AND short_url = ANY($2)
+		RETURNING short_url`
+
+	tx, err := p.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// успокаиваем линтер
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			logger.Error(fmt.Errorf("psql rollbacck error: %w", err))
-		}
-	}()
+	defer rollback(context.Background(), tx)
 
-	query, args, err := sqlx.In(`
-		UPDATE address SET is_deleted=TRUE  
-		WHERE short_url IN (?);`, shortURLs)
+	rows, _ := tx.Query(ctx, query, userID, shortURLs)
+	shorts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if err = notify(ctx, tx, shorts); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// DeleteExpired пометка на удаление ссылок с истёкшим сроком
+func (p *PgxStore) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	storage.MarkWritten(ctx)
+
+	// LIMIT NULL - без ограничения
+	var lim *int
+	if limit > 0 {
+		lim = &limit
+	}
 
+	query := `
+		UPDATE address SET is_deleted=TRUE, deleted_at=now()
+		WHERE short_url IN (
+			SELECT short_url FROM address
+			WHERE expires_at <= $1 AND NOT is_deleted
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING short_url`
+
+	tx, err := p.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err = tx.ExecContext(ctx, p.db.Rebind(query), args...); err != nil {
-		return err
+	defer rollback(context.Background(), tx)
+
+	rows, _ := tx.Query(ctx, query, now, lim)
+	shorts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if err = notify(ctx, tx, shorts); err != nil {
+		return nil, err
 	}
-	return tx.Commit()
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return shorts, nil
 }
 
-// Stats возвращаем статистику
-func (p *PgxStore) Stats(ctx context.Context) (URLs int, users int, err error) {
+// PurgeDeleted окончательное удаление ссылок, помеченных на удаление не позже before.
+// Без free от ссылки остаётся запись без адреса и пользователя, короткая ссылка остаётся занятой.
+func (p *PgxStore) PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) ([]string, error) {
+	storage.MarkWritten(ctx)
+
+	// LIMIT NULL - без ограничения
+	var lim *int
+	if limit > 0 {
+		lim = &limit
+	}
+
 	query := `
-		SELECT 
-			COUNT(DISTINCT user_id) as Users, 
-			COUNT(short_url) as Urls
-		FROM address`
+		DELETE FROM address
+		WHERE short_url IN (
+			SELECT short_url FROM address
+			WHERE is_deleted AND deleted_at <= $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING short_url`
+	if !free {
+		query = `
+			UPDATE address SET origin_url='', user_id=''
+			WHERE short_url IN (
+				SELECT short_url FROM address
+				WHERE is_deleted AND deleted_at <= $1 AND origin_url <> ''
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING short_url`
+	}
 
-	var res struct {
-		Users int
-		Urls  int
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer rollback(context.Background(), tx)
 
-	if err = p.db.GetContext(ctx, &res, query); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, 0, nil
-		}
-		return 0, 0, err
+	rows, _ := tx.Query(ctx, query, before, lim)
+	shorts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if err = notify(ctx, tx, shorts); err != nil {
+		return nil, err
 	}
-	return res.Urls, res.Users, nil
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return shorts, nil
 }
 
-// При первом запуске база может быть пустая
-func createTableIfNonExists(db *sqlx.DB) error {
+// Stats возвращаем статистику, удалённые ссылки не учитываются
+func (p *PgxStore) Stats(ctx context.Context) (URLs int, users int, err error) {
 	query := `
-		CREATE TABLE IF NOT EXISTS address (
-			short_url  VARCHAR (20) PRIMARY KEY,
-			origin_url TEXT NOT NULL,
-			user_id    VARCHAR (36) NOT NULL,
-			is_deleted BOOLEAN NOT NULL
-		);
-		CREATE UNIQUE INDEX IF NOT EXISTS origin_url_idx 
-		ON address (origin_url);
-		CREATE INDEX IF NOT EXISTS user_id_idx 
-		ON address (user_id);`
-	_, err := db.Exec(query)
-	return err
+		SELECT
+			COUNT(DISTINCT user_id) as users,
+			COUNT(short_url) as urls
+		FROM address
+		WHERE NOT is_deleted`
+
+	err = p.read(ctx, func(pool *pgxpool.Pool) error {
+		return pool.QueryRow(ctx, query).Scan(&users, &URLs)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return URLs, users, nil
+}
+
+// чтение ссылки в порядке колонок short_url, origin_url, user_id, is_deleted, expires_at, deleted_at
+func scanData(row pgx.CollectableRow) (model.StoreData, error) {
+	var data model.StoreData
+	err := row.Scan(&data.ShortURL, &data.OriginalURL, &data.UserID, &data.DeletedFlag,
+		&data.ExpiresAt, &data.DeletedAt)
+	return data, err
+}
+
+// нарушение ограничения уникальности
+func isConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code)
+}
+
+// Ошибка нарушения ограничения как конфликт адреса или короткой ссылки.
+// Остальные ошибки возвращаются как есть.
+func conflictError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || !pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
+		return err
+	}
+	if pgErr.ConstraintName == "address_pkey" {
+		return storage.ErrShortConflict
+	}
+	return storage.ErrAddressConflict
+}
+
+// откат незавершённой транзакции
+func rollback(ctx context.Context, tx pgx.Tx) {
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		logger.Error(fmt.Errorf("psql rollback error: %w", err))
+	}
 }
@@ -0,0 +1,49 @@
+package pgxstore
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// Утверждение типа, ошибка компиляции
+var _ storage.DeleteQueue = (*PgxStore)(nil)
+
+// EnqueueDelete постановка задачи удаления в очередь.
+// Повторная постановка той же задачи ничего не меняет.
+func (p *PgxStore) EnqueueDelete(ctx context.Context, job model.DeleteJob) error {
+	query := `
+		INSERT INTO delete_queue (job_id, user_id, short_urls, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (job_id) DO NOTHING`
+
+	_, err := p.pool.Exec(ctx, query, job.ID, job.UserID, job.ShortURLs, job.CreatedAt)
+	return err
+}
+
+// PendingDeletes неподтверждённые задачи удаления.
+// Очередь общая для всех экземпляров сервиса, читается с основного сервера.
+func (p *PgxStore) PendingDeletes(ctx context.Context) ([]model.DeleteJob, error) {
+	query := `
+		SELECT job_id, user_id, short_urls, created_at FROM delete_queue
+		ORDER BY created_at, job_id`
+
+	rows, _ := p.pool.Query(ctx, query)
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.DeleteJob, error) {
+		job := model.DeleteJob{Status: model.DeleteJobPending}
+		err := row.Scan(&job.ID, &job.UserID, &job.ShortURLs, &job.CreatedAt)
+		return job, err
+	})
+}
+
+// AckDeletes удаление выполненных задач из очереди
+func (p *PgxStore) AckDeletes(ctx context.Context, jobIDs []string) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	_, err := p.pool.Exec(ctx, `DELETE FROM delete_queue WHERE job_id = ANY($1)`, jobIDs)
+	return err
+}
@@ -0,0 +1,147 @@
+package pgxstore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/eugene982/url-shortener/internal/logger"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+const (
+	// период проверки реплик по умолчанию
+	defaultReplicaCheck = 5 * time.Second
+	// ожидание ответа реплики при проверке
+	replicaPingTimeout = time.Second
+)
+
+// Option настройка хранилища
+type Option func(*PgxStore)
+
+// WithReplicas реплики только для чтения.
+// Пулы реплик закрываются вместе с хранилищем.
+func WithReplicas(pools ...*pgxpool.Pool) Option {
+	return func(p *PgxStore) {
+		for _, pool := range pools {
+			p.replicas = append(p.replicas, &replica{pool: pool})
+		}
+	}
+}
+
+// WithReplicaCheck период проверки доступности реплик
+func WithReplicaCheck(interval time.Duration) Option {
+	return func(p *PgxStore) {
+		p.replicaCheck = interval
+	}
+}
+
+// реплика для чтения и её доступность по последней проверке
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// Выбор реплики для чтения по кругу среди доступных.
+// nil - читать с основной базы: реплик нет, все недоступны
+// или в этом запросе уже была запись.
+func (p *PgxStore) reader(ctx context.Context) *replica {
+	if len(p.replicas) == 0 || storage.Written(ctx) {
+		return nil
+	}
+
+	start := p.next.Add(1)
+	for i := range p.replicas {
+		r := p.replicas[(int(start)+i)%len(p.replicas)]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// Чтение с реплики с откатом на основную базу.
+// Ссылка, не найденная на реплике, ищется и на основной:
+// реплика может отставать.
+func (p *PgxStore) read(ctx context.Context, fn func(pool *pgxpool.Pool) error) error {
+	r := p.reader(ctx)
+	if r == nil {
+		return fn(p.pool)
+	}
+
+	err := fn(r.pool)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrAddressNotFound) && !p.replicaFailed(ctx, r, err) {
+		return err
+	}
+	return fn(p.pool)
+}
+
+// Ошибка соединения с репликой снимает её с чтения до следующей проверки.
+// Ошибки запроса и отмена контекста к доступности реплики отношения не имеют.
+func (p *PgxStore) replicaFailed(ctx context.Context, r *replica, err error) bool {
+	var pgErr *pgconn.PgError
+	if ctx.Err() != nil || errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) {
+		return false
+	}
+	if r.healthy.Swap(false) {
+		logger.Warn("replica unavailable", "host", r.pool.Config().ConnConfig.Host, "error", err)
+	}
+	return true
+}
+
+// проверка доступности всех реплик
+func (p *PgxStore) checkReplicas(ctx context.Context) {
+	for _, r := range p.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+		err := r.pool.Ping(pingCtx)
+		cancel()
+
+		host := r.pool.Config().ConnConfig.Host
+		if healthy := err == nil; r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				logger.Info("replica available", "host", host)
+			} else {
+				logger.Warn("replica unavailable", "host", host, "error", err)
+			}
+		}
+	}
+}
+
+// фоновая проверка реплик до закрытия хранилища
+func (p *PgxStore) startReplicaCheck() {
+	defer p.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(p.replicaCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.checkReplicas(ctx)
+		}
+	}
+}
+
+// закрытие пулов реплик
+func (p *PgxStore) closeReplicas() {
+	for _, r := range p.replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,131 @@
+// Тестирование выбора реплик для чтения
+
+package pgxstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// хранилище с ленивыми пулами к недоступным адресам, база не нужна
+func newReplicaStore(t *testing.T, replicas int) *PgxStore {
+	t.Helper()
+
+	open := func(host string) *pgxpool.Pool {
+		pool, err := Open(context.Background(), "postgres://test:test@"+host+":1/test", PoolConfig{})
+		require.NoError(t, err)
+		t.Cleanup(pool.Close)
+		return pool
+	}
+
+	p := &PgxStore{pool: open("primary")}
+	for i := 0; i < replicas; i++ {
+		p.replicas = append(p.replicas, &replica{pool: open("localhost")})
+	}
+	return p
+}
+
+func TestReader(t *testing.T) {
+	ctx := context.Background()
+
+	// без реплик всё читается с основной базы
+	assert.Nil(t, newReplicaStore(t, 0).reader(ctx))
+
+	p := newReplicaStore(t, 3)
+
+	// пока проверка не прошла, реплики не используются
+	assert.Nil(t, p.reader(ctx))
+
+	p.replicas[0].healthy.Store(true)
+	p.replicas[2].healthy.Store(true)
+
+	// по кругу среди доступных
+	seen := make(map[*replica]int)
+	for i := 0; i < 10; i++ {
+		r := p.reader(ctx)
+		require.NotNil(t, r)
+		seen[r]++
+	}
+	assert.Len(t, seen, 2)
+	assert.NotContains(t, seen, p.replicas[1])
+
+	// заполнение кеша читает с основной базы
+	assert.Nil(t, p.reader(storage.WithPrimary(ctx)))
+
+	// после записи запрос читает с основной базы
+	ctx = storage.WithSession(ctx)
+	assert.NotNil(t, p.reader(ctx))
+	storage.MarkWritten(ctx)
+	assert.Nil(t, p.reader(ctx))
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	p := newReplicaStore(t, 1)
+	r := p.replicas[0]
+
+	tests := []struct {
+		name     string
+		err      error
+		fallback bool
+		healthy  bool
+	}{
+		{"ok", nil, false, true},
+		{"not_found", storage.ErrAddressNotFound, true, true},
+		{"no_rows", pgx.ErrNoRows, false, true},
+		{"query_error", &pgconn.PgError{Code: "42P01"}, false, true},
+		{"conn_error", errors.New("connection refused"), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.healthy.Store(true)
+
+			var pools []*pgxpool.Pool
+			err := p.read(ctx, func(pool *pgxpool.Pool) error {
+				pools = append(pools, pool)
+				if pool == r.pool {
+					return tt.err
+				}
+				return nil
+			})
+
+			if tt.fallback {
+				assert.NoError(t, err)
+				assert.Equal(t, []*pgxpool.Pool{r.pool, p.pool}, pools)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Equal(t, []*pgxpool.Pool{r.pool}, pools)
+			}
+			assert.Equal(t, tt.healthy, r.healthy.Load())
+		})
+	}
+
+	// отменённый запрос не снимает реплику с чтения
+	r.healthy.Store(true)
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := p.read(cancelCtx, func(pool *pgxpool.Pool) error {
+		return cancelCtx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, r.healthy.Load())
+}
+
+func TestCheckReplicas(t *testing.T) {
+	p := newReplicaStore(t, 1)
+	p.replicas[0].healthy.Store(true)
+
+	// на недоступном адресе проверка снимает реплику с чтения
+	p.checkReplicas(context.Background())
+	assert.False(t, p.replicas[0].healthy.Load())
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Сессия одного запроса к сервису.
+// Хранилище с репликами отмечает в ней запись,
+// после чего чтения этого запроса идут на основную базу.
+type session struct {
+	written atomic.Bool
+}
+
+type sessionKey struct{}
+
+// WithSession контекст с новой сессией чтения своих записей
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// MarkWritten отметка о записи в сессии контекста, если она есть
+func MarkWritten(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.written.Store(true)
+	}
+}
+
+// Written была ли запись в сессии контекста
+func Written(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.written.Load()
+}
+
+// WithPrimary контекст, чтения которого идут на основную базу, минуя реплики
+func WithPrimary(ctx context.Context) context.Context {
+	s := &session{}
+	s.written.Store(true)
+	return context.WithValue(ctx, sessionKey{}, s)
+}
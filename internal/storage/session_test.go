@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	// без сессии отметка ни на что не влияет
+	ctx := context.Background()
+	MarkWritten(ctx)
+	assert.False(t, Written(ctx))
+
+	ctx = WithSession(ctx)
+	assert.False(t, Written(ctx))
+
+	// отметка видна и в производных контекстах
+	child, cancel := context.WithCancel(ctx)
+	defer cancel()
+	MarkWritten(child)
+	assert.True(t, Written(ctx))
+
+	// новая сессия начинается без записи
+	assert.False(t, Written(WithSession(ctx)))
+
+	// чтение с основной базы без записи в сессии запроса
+	primary := WithPrimary(WithSession(context.Background()))
+	assert.True(t, Written(primary))
+}
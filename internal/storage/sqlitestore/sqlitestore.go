@@ -0,0 +1,520 @@
+// Хранение ссылок во встроенной базе SQLite.
+// Для развёртывания без сервера базы данных.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/eugene982/url-shortener/internal/logger"
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+const (
+	// Scheme префикс строки подключения: sqlite://path/to/file.db
+	Scheme = "sqlite://"
+
+	driverName = "sqlite"
+
+	// ожидание блокировки базы другим соединением и журнал упреждающей записи,
+	// чтобы чтение не блокировалось записью.
+	// Время пишется текстом, который в UTC сравнивается по порядку.
+	pragmas = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+)
+
+type SQLiteStore struct {
+	db    *sqlx.DB
+	scope storage.DedupeScope // область уникальности адреса
+}
+
+// Утверждение типа, ошибка компиляции
+var (
+	_ storage.Storage      = (*SQLiteStore)(nil)
+	_ storage.OriginGetter = (*SQLiteStore)(nil)
+	_ storage.IDLeaser     = (*SQLiteStore)(nil)
+)
+
+func init() {
+	sqlx.BindDriver(driverName, sqlx.QUESTION)
+}
+
+// Open открытие файла базы по строке подключения вида sqlite://path
+func Open(dsn string) (*sqlx.DB, error) {
+	path, ok := strings.CutPrefix(dsn, Scheme)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("wrong sqlite dsn %q", dsn)
+	}
+
+	if strings.Contains(path, "?") {
+		path += "&" + pragmas
+	} else {
+		path += "?" + pragmas
+	}
+	return sqlx.Open(driverName, "file:"+path)
+}
+
+// Option настройка хранилища
+type Option func(*SQLiteStore)
+
+// WithDedupe область уникальности полного адреса, по умолчанию storage.DedupeGlobal.
+// При смене области уникальный индекс адресов пересоздаётся при запуске.
+func WithDedupe(scope storage.DedupeScope) Option {
+	return func(s *SQLiteStore) {
+		s.scope = scope
+	}
+}
+
+// New Функция-конструктор
+func New(db *sqlx.DB, opts ...Option) (*SQLiteStore, error) {
+	s := &SQLiteStore{db: db, scope: storage.DedupeGlobal}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	err := db.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = createTableIfNonExists(db); err != nil {
+		return nil, err
+	}
+	if err = createOriginIndex(db, s.scope); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close Закрытие соединения
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping Пинг к базе
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// GetAddr Запрос полного адреса у базы по короткой ссылке
+func (s *SQLiteStore) GetAddr(ctx context.Context, short string) (data model.StoreData, err error) {
+	query := `
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+		WHERE short_url=? LIMIT 1`
+
+	res := model.StoreData{}
+	if err = s.db.GetContext(ctx, &res, query, short); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.StoreData{}, storage.ErrAddressNotFound
+		}
+		return model.StoreData{}, err
+	}
+	return res, nil
+}
+
+// GetByOrigin Получение ссылки по полному адресу в области уникальности
+func (s *SQLiteStore) GetByOrigin(ctx context.Context, userID, origin string) (data model.StoreData, err error) {
+	query := `
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+		WHERE origin_url=? LIMIT 1`
+	args := []any{origin}
+
+	switch s.scope {
+	case storage.DedupeNone:
+		return model.StoreData{}, storage.ErrAddressNotFound
+	case storage.DedupeUser:
+		query = `
+			SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+			WHERE origin_url=? AND user_id=? LIMIT 1`
+		args = append(args, userID)
+	}
+
+	res := model.StoreData{}
+	if err = s.db.GetContext(ctx, &res, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.StoreData{}, storage.ErrAddressNotFound
+		}
+		return model.StoreData{}, err
+	}
+	return res, nil
+}
+
+// Set Установка уникального соответствия
+func (s *SQLiteStore) Set(ctx context.Context, data model.StoreData) error {
+	if ok, err := data.IsValid(); !ok {
+		return err
+	}
+
+	query := `
+		INSERT INTO address (origin_url, short_url, user_id, is_deleted, expires_at, deleted_at)
+		VALUES(:origin_url, :short_url, :user_id, :is_deleted, :expires_at, :deleted_at);`
+	_, err := s.db.NamedExecContext(ctx, query, utcTimes(data))
+	if err == nil {
+		return nil
+	}
+
+	err = conflictError(err)
+	// порядок проверки ограничений sqlite не обещает, а повтор
+	// уже сокращённого адреса - конфликт адреса, а не коллизия ссылки
+	if errors.Is(err, storage.ErrShortConflict) {
+		if _, gerr := s.GetByOrigin(ctx, data.UserID, data.OriginalURL); gerr == nil {
+			return storage.ErrAddressConflict
+		}
+	}
+	return err
+}
+
+// Update Записть в базу соответствия между адресом и короткой ссылкой
+func (s *SQLiteStore) Update(ctx context.Context, list []model.StoreData) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(tx)
+
+	// вне общей уникальности чужая ссылка на тот же адрес остаётся за владельцем
+	owner := ""
+	if s.scope != storage.DedupeGlobal {
+		owner = " AND address.user_id=excluded.user_id"
+	}
+
+	stmt, err := tx.PrepareNamedContext(ctx, `
+		INSERT INTO address
+			(origin_url, short_url, user_id, is_deleted, expires_at, deleted_at)
+		VALUES
+			(:origin_url, :short_url, :user_id, :is_deleted, :expires_at, :deleted_at)
+		ON CONFLICT (short_url)
+		DO UPDATE SET
+			user_id=excluded.user_id,
+			is_deleted=excluded.is_deleted, expires_at=excluded.expires_at,
+			deleted_at=excluded.deleted_at
+		WHERE address.origin_url=excluded.origin_url`+owner+`;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// Обновляем адреса которые есть в базе и добавляем новые, при отсутствии.
+	// Ссылка другого адреса не обновляется.
+	for _, d := range list {
+		res, err := stmt.ExecContext(ctx, utcTimes(d))
+		if err != nil {
+			if isConstraintViolation(err) {
+				err = storage.ErrAddressConflict
+			}
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return storage.ErrShortConflict
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetUserURLs Получение данных пользователя
+func (s *SQLiteStore) GetUserURLs(ctx context.Context, userID string) ([]model.StoreData, error) {
+	res := make([]model.StoreData, 0)
+
+	query := `
+		SELECT short_url, origin_url, user_id, is_deleted, expires_at, deleted_at FROM address
+		WHERE user_id=?`
+
+	err := s.db.SelectContext(ctx, &res, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DeleteShort Удаление указанных сокращённых ссылок
+func (s *SQLiteStore) DeleteShort(ctx context.Context, shortURLs []string) error {
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	// повторное удаление не сдвигает время пометки
+	query, args, err := sqlx.In(`
+		UPDATE address SET is_deleted=TRUE, deleted_at=COALESCE(deleted_at, ?)
+		WHERE short_url IN (?);`, time.Now().UTC(), shortURLs)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// DeleteUserShort пометка на удаление ссылок пользователя
+func (s *SQLiteStore) DeleteUserShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	if len(shortURLs) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`
+		UPDATE address SET is_deleted=TRUE, deleted_at=?
+		WHERE user_id=? AND NOT is_deleted AND short_url IN (?)
+		RETURNING short_url`, time.Now().UTC(), userID, shortURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	var shorts []string
+	if err = s.db.SelectContext(ctx, &shorts, query, args...); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// RestoreShort снятие пометки на удаление с неочищенных ссылок пользователя
+func (s *SQLiteStore) RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	if len(shortURLs) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`
+		UPDATE address SET is_deleted=FALSE, deleted_at=NULL
+		WHERE user_id=? AND is_deleted AND origin_url <> '' AND short_url IN (?)
+		RETURNING short_url`, userID, shortURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	var shorts []string
+	if err = s.db.SelectContext(ctx, &shorts, query, args...); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// DeleteExpired пометка на удаление ссылок с истёкшим сроком
+func (s *SQLiteStore) DeleteExpired(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = -1 // без ограничения
+	}
+
+	query := `
+		UPDATE address SET is_deleted=TRUE, deleted_at=?
+		WHERE short_url IN (
+			SELECT short_url FROM address
+			WHERE NOT is_deleted AND expires_at <= ?
+			LIMIT ?
+		)
+		RETURNING short_url`
+
+	var shorts []string
+	if err := s.db.SelectContext(ctx, &shorts, query, time.Now().UTC(), now.UTC(), limit); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// PurgeDeleted окончательное удаление ссылок, помеченных на удаление не позже before.
+// Без free от ссылки остаётся запись без адреса и пользователя.
+func (s *SQLiteStore) PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) ([]string, error) {
+	if limit <= 0 {
+		limit = -1 // без ограничения
+	}
+
+	query := `
+		DELETE FROM address
+		WHERE short_url IN (
+			SELECT short_url FROM address
+			WHERE is_deleted AND deleted_at <= ?
+			LIMIT ?
+		)
+		RETURNING short_url`
+	if !free {
+		query = `
+			UPDATE address SET origin_url='', user_id=''
+			WHERE short_url IN (
+				SELECT short_url FROM address
+				WHERE is_deleted AND deleted_at <= ? AND origin_url <> ''
+				LIMIT ?
+			)
+			RETURNING short_url`
+	}
+
+	var shorts []string
+	if err := s.db.SelectContext(ctx, &shorts, query, before.UTC(), limit); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// Stats возвращаем статистику, удалённые ссылки не учитываются
+func (s *SQLiteStore) Stats(ctx context.Context) (URLs int, users int, err error) {
+	query := `
+		SELECT
+			COUNT(DISTINCT user_id) as users,
+			COUNT(short_url) as urls
+		FROM address
+		WHERE NOT is_deleted`
+
+	var res struct {
+		Users int
+		Urls  int
+	}
+
+	if err = s.db.GetContext(ctx, &res, query); err != nil {
+		return 0, 0, err
+	}
+	return res.Urls, res.Users, nil
+}
+
+// LeaseIDs блок из n номеров счётчика ссылок.
+// Граница в единственной строке id_lease сдвигается транзакцией до выдачи блока.
+func (s *SQLiteStore) LeaseIDs(ctx context.Context, n uint64) (start uint64, err error) {
+	if n == 0 || n > math.MaxInt64 {
+		return 0, errors.New("wrong id block size")
+	}
+
+	query := `
+		INSERT INTO id_lease (id, next) VALUES (0, ?1)
+		ON CONFLICT (id) DO UPDATE SET next=next+excluded.next
+		RETURNING next-?1`
+
+	err = s.db.GetContext(ctx, &start, query, int64(n))
+	return
+}
+
+// При первом запуске база может быть пустая
+func createTableIfNonExists(db *sqlx.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS id_lease (
+			id   INTEGER PRIMARY KEY CHECK (id = 0),
+			next INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS address (
+			short_url  VARCHAR (20) PRIMARY KEY,
+			origin_url TEXT NOT NULL,
+			user_id    VARCHAR (36) NOT NULL,
+			is_deleted BOOLEAN NOT NULL,
+			expires_at TIMESTAMP,
+			deleted_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS user_id_idx
+		ON address (user_id);`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// таблица могла быть создана до появления срока действия ссылок
+	added, err := addColumn(db, "expires_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
+	// и до появления времени удаления, тогда отсчёт хранения удалённых начинается сейчас
+	if added, err = addColumn(db, "deleted_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if added {
+		_, err = db.Exec(`UPDATE address SET deleted_at=? WHERE is_deleted`, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`
+		DROP INDEX IF EXISTS origin_url_idx;
+		CREATE INDEX IF NOT EXISTS expires_at_idx
+		ON address (expires_at) WHERE expires_at IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS deleted_at_idx
+		ON address (deleted_at) WHERE is_deleted;`)
+	return err
+}
+
+// Уникальный индекс адресов для области scope, индекс другой области удаляется.
+// Очищенные удалённые ссылки хранятся с пустым адресом,
+// поэтому уникальность только у непустых.
+func createOriginIndex(db *sqlx.DB, scope storage.DedupeScope) error {
+	query := `
+		DROP INDEX IF EXISTS origin_user_key;
+		CREATE UNIQUE INDEX IF NOT EXISTS origin_url_key
+		ON address (origin_url) WHERE origin_url <> '';`
+	switch scope {
+	case storage.DedupeUser:
+		query = `
+			DROP INDEX IF EXISTS origin_url_key;
+			CREATE UNIQUE INDEX IF NOT EXISTS origin_user_key
+			ON address (origin_url, user_id) WHERE origin_url <> '';`
+	case storage.DedupeNone:
+		query = `
+			DROP INDEX IF EXISTS origin_url_key;
+			DROP INDEX IF EXISTS origin_user_key;`
+	}
+	_, err := db.Exec(query)
+	return err
+}
+
+// добавление колонки в таблицу, если её нет
+func addColumn(db *sqlx.DB, name, typ string) (bool, error) {
+	var n int
+	err := db.Get(&n, `SELECT COUNT(*) FROM pragma_table_info('address') WHERE name=?`, name)
+	if err != nil || n > 0 {
+		return false, err
+	}
+	if _, err = db.Exec(fmt.Sprintf(`ALTER TABLE address ADD COLUMN %s %s`, name, typ)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// время в UTC, чтобы текстовое сравнение совпадало с временным
+func utcTimes(data model.StoreData) model.StoreData {
+	if data.ExpiresAt != nil {
+		t := data.ExpiresAt.UTC()
+		data.ExpiresAt = &t
+	}
+	if data.DeletedAt != nil {
+		t := data.DeletedAt.UTC()
+		data.DeletedAt = &t
+	}
+	return data
+}
+
+// нарушение ограничения уникальности
+func isConstraintViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT
+}
+
+// Ошибка нарушения ограничения как конфликт адреса или короткой ссылки.
+// Остальные ошибки возвращаются как есть.
+func conflictError(err error) error {
+	var sqliteErr *sqlite.Error
+	switch {
+	case !errors.As(err, &sqliteErr):
+		return err
+	case sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return storage.ErrShortConflict
+	case sqliteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT:
+		return storage.ErrAddressConflict
+	}
+	return err
+}
+
+// откат незавершённой транзакции
+func rollback(tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Error(fmt.Errorf("sqlite rollback error: %w", err))
+	}
+}
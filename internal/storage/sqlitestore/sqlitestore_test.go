@@ -0,0 +1,184 @@
+// Тестирование хранилища SQLite
+
+package sqlitestore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+	"github.com/eugene982/url-shortener/internal/storage/storagetest"
+)
+
+func newTestStore(t *testing.T, opts ...Option) *SQLiteStore {
+	db, err := Open(Scheme + filepath.Join(t.TempDir(), "short-url.db"))
+	require.NoError(t, err)
+
+	store, err := New(db, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open("postgres://localhost")
+	require.Error(t, err)
+
+	_, err = Open(Scheme)
+	require.Error(t, err)
+
+	db, err := Open(Scheme + filepath.Join(t.TempDir(), "short-url.db?cache=shared"))
+	require.NoError(t, err)
+	require.NoError(t, db.Ping())
+	require.NoError(t, db.Close())
+}
+
+func TestPersist(t *testing.T) {
+	dsn := Scheme + filepath.Join(t.TempDir(), "short-url.db")
+	ctx := context.Background()
+
+	db, err := Open(dsn)
+	require.NoError(t, err)
+	store, err := New(db)
+	require.NoError(t, err)
+
+	data := model.StoreData{UserID: "user", ShortURL: "short", OriginalURL: "ya.ru"}
+	require.NoError(t, store.Set(ctx, data))
+	require.NoError(t, store.DeleteShort(ctx, []string{"short"}))
+	require.NoError(t, store.Close())
+
+	db, err = Open(dsn)
+	require.NoError(t, err)
+	store, err = New(db)
+	require.NoError(t, err)
+	defer store.Close()
+
+	get, err := store.GetAddr(ctx, "short")
+	require.NoError(t, err)
+	require.NotNil(t, get.DeletedAt)
+	get.DeletedAt = nil
+	data.DeletedFlag = true
+	assert.Equal(t, data, get)
+}
+
+func TestUpgradeTable(t *testing.T) {
+	db, err := Open(Scheme + filepath.Join(t.TempDir(), "short-url.db"))
+	require.NoError(t, err)
+
+	// таблица прежней версии
+	_, err = db.Exec(`
+		CREATE TABLE address (
+			short_url  VARCHAR (20) PRIMARY KEY,
+			origin_url TEXT NOT NULL,
+			user_id    VARCHAR (36) NOT NULL,
+			is_deleted BOOLEAN NOT NULL
+		);
+		CREATE UNIQUE INDEX origin_url_idx
+		ON address (origin_url);
+		INSERT INTO address VALUES ('s1', 'ya.ru', 'user', TRUE), ('s2', 'go.dev', 'user', TRUE);`)
+	require.NoError(t, err)
+
+	store, err := New(db)
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := context.Background()
+
+	get, err := store.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	require.NotNil(t, get.DeletedAt)
+
+	// очищенные ссылки с пустым адресом не конфликтуют между собой
+	purged, err := store.PurgeDeleted(ctx, time.Now().Add(time.Hour), 0, false)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1", "s2"}, purged)
+
+	err = store.Set(ctx, model.StoreData{ShortURL: "s3", OriginalURL: "go.dev"})
+	require.NoError(t, err)
+	err = store.Set(ctx, model.StoreData{ShortURL: "s4", OriginalURL: "go.dev"})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				err := store.Set(ctx, model.StoreData{
+					UserID:      fmt.Sprint(w),
+					ShortURL:    fmt.Sprintf("s%d-%d", w, i),
+					OriginalURL: fmt.Sprintf("http://%d.ru/%d", w, i),
+				})
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	urls, users, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 160, urls)
+	assert.Equal(t, 8, users)
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newTestStore(t)
+	})
+}
+
+func TestStorageDedupe(t *testing.T) {
+	storagetest.RunDedupe(t, func(t *testing.T, scope storage.DedupeScope) storage.Storage {
+		return newTestStore(t, WithDedupe(scope))
+	})
+}
+
+func TestChangeDedupe(t *testing.T) {
+	dsn := Scheme + filepath.Join(t.TempDir(), "short-url.db")
+	ctx := context.Background()
+
+	open := func(scope storage.DedupeScope) (*SQLiteStore, error) {
+		db, err := Open(dsn)
+		require.NoError(t, err)
+		return New(db, WithDedupe(scope))
+	}
+
+	store, err := open(storage.DedupeUser)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "a", ShortURL: "s1", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Set(ctx, model.StoreData{UserID: "b", ShortURL: "s2", OriginalURL: "ya.ru"}))
+	require.NoError(t, store.Close())
+
+	// общая уникальность невозможна, пока адрес сокращён дважды
+	_, err = open(storage.DedupeGlobal)
+	require.Error(t, err)
+
+	store, err = open(storage.DedupeUser)
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteShort(ctx, []string{"s2"}))
+	_, err = store.PurgeDeleted(ctx, time.Now().Add(time.Hour), 0, true)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = open(storage.DedupeGlobal)
+	require.NoError(t, err)
+	defer store.Close()
+
+	get, err := store.GetByOrigin(ctx, "b", "ya.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "s1", get.ShortURL)
+	err = store.Set(ctx, model.StoreData{UserID: "b", ShortURL: "s3", OriginalURL: "ya.ru"})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/eugene982/url-shortener/internal/model"
 )
@@ -13,16 +14,106 @@ var (
 
 	// ошибка возвращается при наличи уже сохраненного адреса
 	ErrAddressConflict = errors.New("address conflict")
+
+	// ошибка возвращается, если короткая ссылка уже занята другим адресом.
+	// Частный случай ErrAddressConflict, errors.Is находит обе.
+	ErrShortConflict error = shortConflictError{}
 )
 
+type shortConflictError struct{}
+
+func (shortConflictError) Error() string { return "short url conflict" }
+
+func (shortConflictError) Is(target error) bool { return target == ErrAddressConflict }
+
 // Storage интрефейс хранилища ссылок пользователей
 type Storage interface {
 	Close() error
 	Ping(context.Context) error
 	GetAddr(ctx context.Context, short string) (data model.StoreData, err error)
 	Set(ctx context.Context, data model.StoreData) error
+	// запись батча: новые ссылки добавляются, существующие обновляются.
+	// Ссылка, занятая другим полным адресом, не заменяется: ErrShortConflict.
+	// Вне общей уникальности адреса так же не заменяется ссылка другого пользователя.
 	Update(ctx context.Context, list []model.StoreData) error
 	GetUserURLs(ctx context.Context, userID string) ([]model.StoreData, error)
 	DeleteShort(ctx context.Context, shortURLs []string) error
+	// пометка на удаление только ссылок пользователя userID.
+	// Возвращает помеченные ссылки, остальные не найдены, принадлежат другому
+	// или уже помечены раньше.
+	DeleteUserShort(ctx context.Context, userID string, shortURLs []string) ([]string, error)
+	// снятие пометки на удаление с неочищенных ссылок пользователя.
+	// Возвращает восстановленные ссылки.
+	RestoreShort(ctx context.Context, userID string, shortURLs []string) ([]string, error)
+	// пометка на удаление ссылок, срок которых истёк к now, не больше limit при limit > 0.
+	// Возвращает помеченные ссылки.
+	DeleteExpired(ctx context.Context, now time.Time, limit int) ([]string, error)
+	// окончательное удаление ссылок, помеченных на удаление не позже before, не больше limit при limit > 0.
+	// С free короткие ссылки освобождаются для повторного использования,
+	// иначе от ссылки остаётся пустая удалённая запись. Возвращает удалённые ссылки.
+	PurgeDeleted(ctx context.Context, before time.Time, limit int, free bool) ([]string, error)
 	Stats(ctx context.Context) (URLs int, users int, err error)
 }
+
+// Unwrapper декоратор хранилища, например кеш
+type Unwrapper interface {
+	Unwrap() Storage
+}
+
+// As поиск в цепочке декораторов хранилища, реализующего интерфейс T
+func As[T any](s any) (T, bool) {
+	for s != nil {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+		u, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// OriginGetter поиск сохранённой ссылки по полному адресу.
+// Нужен, когда короткая ссылка не вычисляется по адресу заново.
+// Ищется ссылка, с которой адрес конфликтует в области уникальности
+// хранилища: при DedupeGlobal любого пользователя, при DedupeUser
+// только userID, без уникальности не ищется и не находится.
+type OriginGetter interface {
+	GetByOrigin(ctx context.Context, userID, origin string) (model.StoreData, error)
+}
+
+// Invalidator сброс закешированных ссылок
+type Invalidator interface {
+	Invalidate(shorts ...string)
+	InvalidateAll()
+}
+
+// ChangeListener хранилище, общее для нескольких экземпляров сервиса,
+// с подпиской на изменения ссылок. Работает до отмены ctx.
+type ChangeListener interface {
+	ListenChanges(ctx context.Context, inv Invalidator)
+}
+
+// DeleteQueue хранилище с надёжной очередью задач удаления.
+// Задача остаётся в очереди до подтверждения и после перезапуска
+// возвращается снова, поэтому удаление выполняется хотя бы один раз.
+type DeleteQueue interface {
+	// постановка задачи в очередь
+	EnqueueDelete(ctx context.Context, job model.DeleteJob) error
+	// неподтверждённые задачи в порядке постановки
+	PendingDeletes(ctx context.Context) ([]model.DeleteJob, error)
+	// подтверждение выполненных задач, они удаляются из очереди
+	AckDeletes(ctx context.Context, jobIDs []string) error
+}
+
+// IDLeaser хранилище, выдающее блоки номеров для счётчика коротких ссылок.
+// Блоки не пересекаются между экземплярами сервиса, перезапусками и сбоями:
+// блок выдаётся только после надёжной записи его конца.
+// Неиспользованный остаток блока пропадает.
+type IDLeaser interface {
+	// блок из n номеров, начиная с start
+	LeaseIDs(ctx context.Context, n uint64) (start uint64, err error)
+}
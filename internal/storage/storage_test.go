@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type closer interface{ Close() error }
+
+// декоратор поверх хранилища
+type wrapped struct {
+	Storage
+	inner Storage
+}
+
+func (w wrapped) Unwrap() Storage {
+	return w.inner
+}
+
+// хранилище с дополнительным интерфейсом
+type named struct {
+	Storage
+}
+
+func (named) Name() string { return "named" }
+
+func TestAs(t *testing.T) {
+	type namer interface{ Name() string }
+
+	inner := named{}
+	s := wrapped{inner: wrapped{inner: inner}}
+
+	n, ok := As[namer](s)
+	assert.True(t, ok)
+	assert.Equal(t, "named", n.Name())
+
+	// ближайший в цепочке
+	c, ok := As[closer](s)
+	assert.True(t, ok)
+	assert.Equal(t, s, c)
+
+	_, ok = As[namer](wrapped{})
+	assert.False(t, ok)
+	_, ok = As[namer](nil)
+	assert.False(t, ok)
+}
@@ -0,0 +1,922 @@
+// Пакет storagetest общий набор проверок поведения хранилища.
+// Каждая реализация storage.Storage подключает его в своих тестах:
+//
+//	func TestStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			...
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene982/url-shortener/internal/model"
+	"github.com/eugene982/url-shortener/internal/storage"
+)
+
+// NewStore создание нового пустого хранилища для проверки.
+// Закрытие хранилища остаётся на стороне теста.
+type NewStore func(t *testing.T) storage.Storage
+
+// Run запуск всех проверок, каждая на своём пустом хранилище
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"Ping", testPing},
+		{"Set", testSet},
+		{"SetInvalid", testSetInvalid},
+		{"GetByOrigin", testGetByOrigin},
+		{"Update", testUpdate},
+		{"UpdateConflict", testUpdateConflict},
+		{"DeleteShort", testDeleteShort},
+		{"DeleteUserShort", testDeleteUserShort},
+		{"Restore", testRestore},
+		{"GetUserURLs", testGetUserURLs},
+		{"Stats", testStats},
+		{"Expired", testExpired},
+		{"Purge", testPurge},
+		{"DeleteQueue", testDeleteQueue},
+		{"LeaseIDs", testLeaseIDs},
+		{"Canceled", testCanceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// NewScopedStore создание пустого хранилища с областью уникальности адреса
+type NewScopedStore func(t *testing.T, scope storage.DedupeScope) storage.Storage
+
+// RunDedupe проверки уникальности адреса вне общей области.
+// Общая область по умолчанию проверяется в Run.
+func RunDedupe(t *testing.T, newStore NewScopedStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, scope storage.DedupeScope, s storage.Storage)
+	}{
+		{"Set", testDedupeSet},
+		{"Update", testDedupeUpdate},
+		{"GetByOrigin", testDedupeGetByOrigin},
+	}
+
+	for _, scope := range []storage.DedupeScope{storage.DedupeUser, storage.DedupeNone} {
+		t.Run(string(scope), func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					tt.fn(t, scope, newStore(t, scope))
+				})
+			}
+		})
+	}
+}
+
+// адрес, сокращённый одним пользователем, доступен для сокращения другому
+func testDedupeSet(t *testing.T, scope storage.DedupeScope, s storage.Storage) {
+	ctx := context.Background()
+
+	first := model.StoreData{UserID: "a", ShortURL: "s1", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, first))
+
+	other := model.StoreData{UserID: "b", ShortURL: "s2", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, other))
+
+	list, err := s.GetUserURLs(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s2"}, shorts(list))
+
+	// повтор тем же пользователем
+	err = s.Set(ctx, model.StoreData{UserID: "a", ShortURL: "s3", OriginalURL: "ya.ru"})
+	if scope == storage.DedupeNone {
+		require.NoError(t, err)
+	} else {
+		require.ErrorIs(t, err, storage.ErrAddressConflict)
+		require.NotErrorIs(t, err, storage.ErrShortConflict)
+	}
+
+	// короткая ссылка по-прежнему уникальна
+	err = s.Set(ctx, model.StoreData{UserID: "c", ShortURL: "s1", OriginalURL: "ya.ru"})
+	require.ErrorIs(t, err, storage.ErrShortConflict)
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assertData(t, first, get)
+}
+
+// батч не забирает ссылку другого пользователя на тот же адрес
+func testDedupeUpdate(t *testing.T, scope storage.DedupeScope, s storage.Storage) {
+	ctx := context.Background()
+
+	first := model.StoreData{UserID: "a", ShortURL: "s1", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Update(ctx, []model.StoreData{first}))
+
+	err := s.Update(ctx, []model.StoreData{{UserID: "b", ShortURL: "s1", OriginalURL: "ya.ru"}})
+	require.ErrorIs(t, err, storage.ErrShortConflict)
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assertData(t, first, get)
+
+	// своя ссылка на тот же адрес
+	other := model.StoreData{UserID: "b", ShortURL: "s2", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Update(ctx, []model.StoreData{other}))
+	require.NoError(t, s.Update(ctx, []model.StoreData{other}))
+
+	err = s.Update(ctx, []model.StoreData{{UserID: "a", ShortURL: "s3", OriginalURL: "ya.ru"}})
+	if scope == storage.DedupeNone {
+		require.NoError(t, err)
+	} else {
+		require.ErrorIs(t, err, storage.ErrAddressConflict)
+		require.NotErrorIs(t, err, storage.ErrShortConflict)
+	}
+
+	URLs, users, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, users)
+	if scope == storage.DedupeNone {
+		assert.Equal(t, 3, URLs)
+	} else {
+		assert.Equal(t, 2, URLs)
+	}
+}
+
+// ссылка ищется только в области уникальности адреса
+func testDedupeGetByOrigin(t *testing.T, scope storage.DedupeScope, s storage.Storage) {
+	g, ok := storage.As[storage.OriginGetter](s)
+	if !ok {
+		t.Skip("storage has no origin lookup")
+	}
+	ctx := context.Background()
+
+	first := model.StoreData{UserID: "a", ShortURL: "s1", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, first))
+
+	_, err := g.GetByOrigin(ctx, "b", "ya.ru")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+
+	get, err := g.GetByOrigin(ctx, "a", "ya.ru")
+	if scope == storage.DedupeNone {
+		require.ErrorIs(t, err, storage.ErrAddressNotFound)
+		return
+	}
+	require.NoError(t, err)
+	assertData(t, first, get)
+
+	other := model.StoreData{UserID: "b", ShortURL: "s2", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, other))
+	get, err = g.GetByOrigin(ctx, "b", "ya.ru")
+	require.NoError(t, err)
+	assertData(t, other, get)
+}
+
+func testPing(t *testing.T, s storage.Storage) {
+	require.NoError(t, s.Ping(context.Background()))
+}
+
+// Set сохраняет только новые полный адрес и короткую ссылку
+func testSet(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetAddr(ctx, "short")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+
+	data := model.StoreData{UserID: "user", ShortURL: "short", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, data))
+
+	get, err := s.GetAddr(ctx, "short")
+	require.NoError(t, err)
+	assertData(t, data, get)
+	require.NoError(t, s.Set(ctx, model.StoreData{UserID: "user", ShortURL: "short2", OriginalURL: "bing.com"}))
+
+	tests := []struct {
+		name  string
+		data  model.StoreData
+		short bool // занята только короткая ссылка
+	}{
+		{"same", data, false},
+		{"same origin", model.StoreData{UserID: "other", ShortURL: "other", OriginalURL: "ya.ru"}, false},
+		{"same short", model.StoreData{UserID: "other", ShortURL: "short", OriginalURL: "go.dev"}, true},
+		{"both taken", model.StoreData{UserID: "user", ShortURL: "short", OriginalURL: "bing.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Set(ctx, tt.data)
+			require.ErrorIs(t, err, storage.ErrAddressConflict)
+			// сокращённый адрес важнее занятой ссылки
+			if tt.short {
+				require.ErrorIs(t, err, storage.ErrShortConflict)
+			} else {
+				require.NotErrorIs(t, err, storage.ErrShortConflict)
+			}
+		})
+	}
+
+	// конфликт ничего не меняет
+	get, err = s.GetAddr(ctx, "short")
+	require.NoError(t, err)
+	assertData(t, data, get)
+
+	_, err = s.GetAddr(ctx, "other")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+}
+
+// GetByOrigin находит ссылку, которой сейчас занят полный адрес
+func testGetByOrigin(t *testing.T, s storage.Storage) {
+	g, ok := storage.As[storage.OriginGetter](s)
+	if !ok {
+		t.Skip("storage has no origin lookup")
+	}
+	ctx := context.Background()
+
+	_, err := g.GetByOrigin(ctx, "user", "ya.ru")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+
+	data := model.StoreData{UserID: "user", ShortURL: "short", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, data))
+
+	get, err := g.GetByOrigin(ctx, "user", "ya.ru")
+	require.NoError(t, err)
+	assertData(t, data, get)
+
+	// адрес общий для всех пользователей
+	get, err = g.GetByOrigin(ctx, "other", "ya.ru")
+	require.NoError(t, err)
+	assertData(t, data, get)
+
+	// удалённая ссылка по-прежнему занимает адрес
+	require.NoError(t, s.DeleteShort(ctx, []string{"short"}))
+	get, err = g.GetByOrigin(ctx, "user", "ya.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "short", get.ShortURL)
+	assert.True(t, get.DeletedFlag)
+
+	// очищенная освобождает адрес
+	_, err = s.PurgeDeleted(ctx, time.Now().Add(time.Hour), 0, false)
+	require.NoError(t, err)
+	_, err = g.GetByOrigin(ctx, "user", "ya.ru")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+}
+
+// Set проверяет данные раньше конфликта
+func testSetInvalid(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Set(ctx, model.StoreData{ShortURL: "short", OriginalURL: "ya.ru"}))
+
+	tests := []struct {
+		name string
+		data model.StoreData
+	}{
+		{"empty short", model.StoreData{OriginalURL: "ya.ru"}},
+		{"empty origin", model.StoreData{ShortURL: "short"}},
+		{"spaces", model.StoreData{ShortURL: " ", OriginalURL: "\t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Set(ctx, tt.data)
+			require.Error(t, err)
+			assert.NotErrorIs(t, err, storage.ErrAddressConflict)
+		})
+	}
+}
+
+// Update добавляет новые ссылки и обновляет существующие ссылки того же адреса
+func testUpdate(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Update(ctx, nil))
+
+	list := []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+	}
+	require.NoError(t, s.Update(ctx, list))
+	// повтор того же батча
+	require.NoError(t, s.Update(ctx, list))
+
+	for _, want := range list {
+		get, err := s.GetAddr(ctx, want.ShortURL)
+		require.NoError(t, err)
+		assertData(t, want, get)
+	}
+
+	// замена владельца
+	moved := model.StoreData{UserID: "other", ShortURL: "s1", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Update(ctx, []model.StoreData{moved}))
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assertData(t, moved, get)
+}
+
+// Update не занимает полный адрес другой короткой ссылки
+func testUpdateConflict(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	data := model.StoreData{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(ctx, data))
+
+	err := s.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s2", OriginalURL: "ya.ru"},
+	})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+
+	_, err = s.GetAddr(ctx, "s2")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assertData(t, data, get)
+
+	// короткая ссылка другого адреса не заменяется, батч не пишется
+	err = s.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s3", OriginalURL: "go.dev"},
+		{UserID: "other", ShortURL: "s1", OriginalURL: "https://ya.ru"},
+	})
+	require.ErrorIs(t, err, storage.ErrShortConflict)
+
+	_, err = s.GetAddr(ctx, "s3")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+
+	get, err = s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assertData(t, data, get)
+
+	// короткая ссылка повторяется в батче с другим адресом
+	err = s.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "dup", OriginalURL: "a.ru"},
+		{UserID: "user", ShortURL: "dup", OriginalURL: "b.ru"},
+	})
+	require.ErrorIs(t, err, storage.ErrShortConflict)
+
+	_, err = s.GetAddr(ctx, "dup")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+
+	// адрес повторяется в батче с другой короткой ссылкой
+	err = s.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "d1", OriginalURL: "c.ru"},
+		{UserID: "user", ShortURL: "d2", OriginalURL: "c.ru"},
+	})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+
+	_, err = s.GetAddr(ctx, "d1")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+}
+
+// DeleteShort только помечает ссылки, неизвестные ссылки пропускаются
+func testDeleteShort(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+	}))
+
+	require.NoError(t, s.DeleteShort(ctx, nil))
+	require.NoError(t, s.DeleteShort(ctx, []string{"s1", "none"}))
+	// повторное удаление
+	require.NoError(t, s.DeleteShort(ctx, []string{"s1"}))
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, get.DeletedFlag)
+	assert.Equal(t, "ya.ru", get.OriginalURL)
+
+	get, err = s.GetAddr(ctx, "s2")
+	require.NoError(t, err)
+	assert.False(t, get.DeletedFlag)
+
+	// адрес удалённой ссылки остаётся занятым
+	err = s.Set(ctx, model.StoreData{UserID: "user", ShortURL: "s3", OriginalURL: "ya.ru"})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+}
+
+// RestoreShort снимает пометку на удаление только с неочищенных ссылок пользователя
+// DeleteUserShort помечает на удаление только ссылки пользователя
+func testDeleteUserShort(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+		{UserID: "u1", ShortURL: "s2", OriginalURL: "a2"},
+		{UserID: "u2", ShortURL: "s3", OriginalURL: "a3"},
+	}))
+
+	deleted, err := s.DeleteUserShort(ctx, "u1", []string{"s1", "s3", "s9", "s1"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1"}, deleted)
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, get.DeletedFlag)
+	require.NotNil(t, get.DeletedAt)
+	deletedAt := *get.DeletedAt
+
+	// чужая ссылка не тронута
+	get, err = s.GetAddr(ctx, "s3")
+	require.NoError(t, err)
+	assert.False(t, get.DeletedFlag)
+
+	// уже удалённая ссылка повторно не удаляется и время пометки не сдвигается
+	deleted, err = s.DeleteUserShort(ctx, "u1", []string{"s1", "s2"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s2"}, deleted)
+
+	get, err = s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	require.NotNil(t, get.DeletedAt)
+	assert.True(t, deletedAt.Equal(*get.DeletedAt))
+
+	deleted, err = s.DeleteUserShort(ctx, "u1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	urls, users, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, urls)
+	assert.Equal(t, 1, users)
+}
+
+func testRestore(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Set(ctx, model.StoreData{UserID: "u1", ShortURL: "s3", OriginalURL: "a3"}))
+	require.NoError(t, s.DeleteShort(ctx, []string{"s3"}))
+	_, err := s.PurgeDeleted(ctx, time.Now().Add(time.Hour), 0, false)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+		{UserID: "u1", ShortURL: "s2", OriginalURL: "a2"},
+		{UserID: "u2", ShortURL: "s4", OriginalURL: "a4"},
+	}))
+	require.NoError(t, s.DeleteShort(ctx, []string{"s1", "s4"}))
+
+	restored, err := s.RestoreShort(ctx, "u1", nil)
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	// s2 не удалена, s3 очищена, s4 чужая
+	restored, err = s.RestoreShort(ctx, "u1", []string{"s1", "s2", "s3", "s4", "none"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s1"}, restored)
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assertData(t, model.StoreData{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"}, get)
+
+	get, err = s.GetAddr(ctx, "s4")
+	require.NoError(t, err)
+	assert.True(t, get.DeletedFlag)
+
+	// повторное восстановление
+	restored, err = s.RestoreShort(ctx, "u1", []string{"s1"})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	urls, users, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, urls)
+	assert.Equal(t, 1, users)
+}
+
+// GetUserURLs возвращает все ссылки пользователя, в том числе удалённые
+func testGetUserURLs(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+		{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+		{UserID: "other", ShortURL: "s3", OriginalURL: "google.com"},
+	}))
+	require.NoError(t, s.DeleteShort(ctx, []string{"s2"}))
+
+	list, err := s.GetUserURLs(ctx, "user")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1", "s2"}, shorts(list))
+	for _, d := range list {
+		assert.Equal(t, "user", d.UserID)
+		assert.Equal(t, d.ShortURL == "s2", d.DeletedFlag, d.ShortURL)
+	}
+
+	list, err = s.GetUserURLs(ctx, "none")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+// Stats считает неудалённые ссылки и пользователей, у которых они есть
+func testStats(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		update []model.StoreData
+		delete []string
+		urls   int
+		users  int
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "new",
+			update: []model.StoreData{
+				{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+				{UserID: "user", ShortURL: "s2", OriginalURL: "go.dev"},
+				{UserID: "other", ShortURL: "s3", OriginalURL: "google.com"},
+			},
+			urls:  3,
+			users: 2,
+		},
+		{
+			name: "replace",
+			update: []model.StoreData{
+				{UserID: "user", ShortURL: "s1", OriginalURL: "ya.ru"},
+			},
+			urls:  3,
+			users: 2,
+		},
+		{
+			name:   "delete",
+			delete: []string{"s1"},
+			urls:   2,
+			users:  2,
+		},
+		{
+			name:   "delete last user link",
+			delete: []string{"s3", "s3"},
+			urls:   1,
+			users:  1,
+		},
+		{
+			name: "move link",
+			update: []model.StoreData{
+				{UserID: "third", ShortURL: "s2", OriginalURL: "go.dev"},
+			},
+			urls:  1,
+			users: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, s.Update(ctx, tt.update))
+			require.NoError(t, s.DeleteShort(ctx, tt.delete))
+
+			urls, users, err := s.Stats(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.urls, urls, "urls")
+			assert.Equal(t, tt.users, users, "users")
+		})
+	}
+}
+
+// DeleteExpired помечает на удаление ссылки с истёкшим сроком
+func testExpired(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	list := []model.StoreData{
+		{UserID: "u1", ShortURL: "s1", OriginalURL: "a1", ExpiresAt: at(-time.Hour)},
+		{UserID: "u1", ShortURL: "s2", OriginalURL: "a2", ExpiresAt: at(-time.Minute)},
+		{UserID: "u2", ShortURL: "s3", OriginalURL: "a3", ExpiresAt: at(-time.Second)},
+		{UserID: "u2", ShortURL: "s4", OriginalURL: "a4", ExpiresAt: at(time.Hour)},
+		{UserID: "u2", ShortURL: "s5", OriginalURL: "a5"},
+	}
+	require.NoError(t, s.Set(ctx, list[0]))
+	require.NoError(t, s.Update(ctx, list[1:]))
+
+	// срок сохраняется вместе со ссылкой
+	for _, d := range list {
+		get, err := s.GetAddr(ctx, d.ShortURL)
+		require.NoError(t, err)
+		assertData(t, d, get)
+	}
+
+	// удалённая вручную ссылка повторно не считается
+	require.NoError(t, s.DeleteShort(ctx, []string{"s3"}))
+
+	first, err := s.DeleteExpired(ctx, now, 1)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	rest, err := s.DeleteExpired(ctx, now, 0)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1", "s2"}, append(first, rest...))
+
+	rest, err = s.DeleteExpired(ctx, now, 0)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	for _, d := range list {
+		get, err := s.GetAddr(ctx, d.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, d.ExpiresAt != nil && d.ExpiresAt.Before(now), get.DeletedFlag, d.ShortURL)
+	}
+
+	urls, users, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, urls)
+	assert.Equal(t, 1, users)
+
+	// продление срока перезаписью
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "u2", ShortURL: "s4", OriginalURL: "a4", ExpiresAt: at(3 * time.Hour)},
+	}))
+	rest, err = s.DeleteExpired(ctx, now.Add(2*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	// снятие срока
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "u2", ShortURL: "s4", OriginalURL: "a4"},
+	}))
+	rest, err = s.DeleteExpired(ctx, now.Add(4*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	get, err := s.GetAddr(ctx, "s4")
+	require.NoError(t, err)
+	assert.Nil(t, get.ExpiresAt)
+}
+
+// PurgeDeleted окончательно удаляет ссылки, помеченные на удаление раньше срока хранения
+func testPurge(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Update(ctx, []model.StoreData{
+		{UserID: "u1", ShortURL: "s1", OriginalURL: "a1"},
+		{UserID: "u1", ShortURL: "s2", OriginalURL: "a2"},
+		{UserID: "u1", ShortURL: "s3", OriginalURL: "a3"},
+	}))
+	require.NoError(t, s.DeleteShort(ctx, []string{"s1", "s2"}))
+
+	get, err := s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	require.NotNil(t, get.DeletedAt)
+
+	// срок хранения ещё не прошёл
+	purged, err := s.PurgeDeleted(ctx, get.DeletedAt.Add(-time.Hour), 0, false)
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+
+	before := time.Now().Add(time.Hour)
+	first, err := s.PurgeDeleted(ctx, before, 1, false)
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+
+	rest, err := s.PurgeDeleted(ctx, before, 0, false)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1", "s2"}, append(first, rest...))
+
+	// очищенные повторно не считаются
+	rest, err = s.PurgeDeleted(ctx, before, 0, false)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+
+	// данные стёрты, короткая ссылка остаётся занятой
+	get, err = s.GetAddr(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, get.Purged())
+	assert.Empty(t, get.UserID)
+
+	err = s.Set(ctx, model.StoreData{UserID: "u2", ShortURL: "s1", OriginalURL: "b1"})
+	require.ErrorIs(t, err, storage.ErrAddressConflict)
+
+	// адрес освобождён
+	require.NoError(t, s.Set(ctx, model.StoreData{UserID: "u2", ShortURL: "s4", OriginalURL: "a1"}))
+
+	list, err := s.GetUserURLs(ctx, "u1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s3"}, shorts(list))
+
+	urls, users, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, urls)
+	assert.Equal(t, 2, users)
+
+	// освобождение коротких ссылок, в том числе неочищенных
+	require.NoError(t, s.DeleteShort(ctx, []string{"s3"}))
+	purged, err = s.PurgeDeleted(ctx, before, 0, true)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1", "s2", "s3"}, purged)
+
+	for _, short := range purged {
+		_, err = s.GetAddr(ctx, short)
+		require.ErrorIs(t, err, storage.ErrAddressNotFound)
+	}
+	require.NoError(t, s.Set(ctx, model.StoreData{UserID: "u2", ShortURL: "s1", OriginalURL: "b1"}))
+	require.NoError(t, s.Set(ctx, model.StoreData{UserID: "u2", ShortURL: "s5", OriginalURL: "a3"}))
+
+	list, err = s.GetUserURLs(ctx, "u1")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+// задачи удаления остаются в очереди до подтверждения,
+// проверяется только у хранилищ с надёжной очередью
+func testDeleteQueue(t *testing.T, s storage.Storage) {
+	q, ok := storage.As[storage.DeleteQueue](s)
+	if !ok {
+		t.Skip("storage has no delete queue")
+	}
+	ctx := context.Background()
+
+	list, err := q.PendingDeletes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	jobs := []model.DeleteJob{
+		{ID: "j2", UserID: "u1", ShortURLs: []string{"s1", "s2"}, CreatedAt: created},
+		{ID: "j1", UserID: "u2", ShortURLs: []string{"s3"}, CreatedAt: created.Add(time.Second)},
+	}
+	for _, job := range jobs {
+		require.NoError(t, q.EnqueueDelete(ctx, job))
+	}
+	// повторная постановка не дублирует задачу
+	require.NoError(t, q.EnqueueDelete(ctx, jobs[0]))
+
+	list, err = q.PendingDeletes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	for i, job := range list {
+		assert.Equal(t, jobs[i].ID, job.ID)
+		assert.Equal(t, jobs[i].UserID, job.UserID)
+		assert.Equal(t, jobs[i].ShortURLs, job.ShortURLs)
+		assert.True(t, jobs[i].CreatedAt.Equal(job.CreatedAt))
+		assert.Equal(t, model.DeleteJobPending, job.Status)
+	}
+
+	require.NoError(t, q.AckDeletes(ctx, []string{"j2", "unknown"}))
+	list, err = q.PendingDeletes(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "j1", list[0].ID)
+
+	require.NoError(t, q.AckDeletes(ctx, nil))
+	require.NoError(t, q.AckDeletes(ctx, []string{"j1"}))
+	list, err = q.PendingDeletes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+// блоки номеров не пересекаются, в том числе при одновременной выдаче
+func testLeaseIDs(t *testing.T, s storage.Storage) {
+	l, ok := storage.As[storage.IDLeaser](s)
+	if !ok {
+		t.Skip("storage has no id leaser")
+	}
+	ctx := context.Background()
+
+	_, err := l.LeaseIDs(ctx, 0)
+	require.Error(t, err)
+
+	first, err := l.LeaseIDs(ctx, 10)
+	require.NoError(t, err)
+	second, err := l.LeaseIDs(ctx, 5)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, second, first+10)
+
+	const workers, size = 8, 3
+	starts := make([]uint64, workers)
+	var wg sync.WaitGroup
+	for i := range starts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start, err := l.LeaseIDs(ctx, size)
+			assert.NoError(t, err)
+			starts[i] = start
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	assert.GreaterOrEqual(t, starts[0], second+5)
+	for i := 1; i < len(starts); i++ {
+		assert.GreaterOrEqual(t, starts[i], starts[i-1]+size)
+	}
+}
+
+// отменённый контекст прерывает любую операцию
+func testCanceled(t *testing.T, s storage.Storage) {
+	data := model.StoreData{UserID: "user", ShortURL: "short", OriginalURL: "ya.ru"}
+	require.NoError(t, s.Set(context.Background(), data))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Ping", func() error {
+			return s.Ping(ctx)
+		}},
+		{"GetAddr", func() error {
+			_, err := s.GetAddr(ctx, "short")
+			return err
+		}},
+		{"Set", func() error {
+			return s.Set(ctx, model.StoreData{ShortURL: "new", OriginalURL: "go.dev"})
+		}},
+		{"Update", func() error {
+			return s.Update(ctx, []model.StoreData{{ShortURL: "new", OriginalURL: "go.dev"}})
+		}},
+		{"GetByOrigin", func() error {
+			g, ok := storage.As[storage.OriginGetter](s)
+			if !ok {
+				return ctx.Err()
+			}
+			_, err := g.GetByOrigin(ctx, "user", "ya.ru")
+			return err
+		}},
+		{"LeaseIDs", func() error {
+			l, ok := storage.As[storage.IDLeaser](s)
+			if !ok {
+				return ctx.Err()
+			}
+			_, err := l.LeaseIDs(ctx, 1)
+			return err
+		}},
+		{"GetUserURLs", func() error {
+			_, err := s.GetUserURLs(ctx, "user")
+			return err
+		}},
+		{"DeleteShort", func() error {
+			return s.DeleteShort(ctx, []string{"short"})
+		}},
+		{"DeleteUserShort", func() error {
+			_, err := s.DeleteUserShort(ctx, "user", []string{"short"})
+			return err
+		}},
+		{"RestoreShort", func() error {
+			_, err := s.RestoreShort(ctx, "user", []string{"short"})
+			return err
+		}},
+		{"Stats", func() error {
+			_, _, err := s.Stats(ctx)
+			return err
+		}},
+		{"DeleteExpired", func() error {
+			_, err := s.DeleteExpired(ctx, time.Now(), 0)
+			return err
+		}},
+		{"PurgeDeleted", func() error {
+			_, err := s.PurgeDeleted(ctx, time.Now(), 0, true)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.fn(), context.Canceled)
+		})
+	}
+
+	// ничего не изменилось
+	get, err := s.GetAddr(context.Background(), "short")
+	require.NoError(t, err)
+	assertData(t, data, get)
+
+	_, err = s.GetAddr(context.Background(), "new")
+	require.ErrorIs(t, err, storage.ErrAddressNotFound)
+}
+
+// сравнение без идентификатора, его назначает хранилище
+func assertData(t *testing.T, want, got model.StoreData) {
+	t.Helper()
+	got.ID = ""
+	want.ID = ""
+
+	// базы возвращают время в своём часовом поясе
+	if want.ExpiresAt != nil && got.ExpiresAt != nil {
+		assert.True(t, want.ExpiresAt.Equal(*got.ExpiresAt), "expires at %v, want %v", got.ExpiresAt, want.ExpiresAt)
+		want.ExpiresAt, got.ExpiresAt = nil, nil
+	}
+	assert.Equal(t, want, got)
+}
+
+func shorts(list []model.StoreData) []string {
+	res := make([]string, len(list))
+	for i, d := range list {
+		res[i] = d.ShortURL
+	}
+	return res
+}